@@ -1,13 +1,35 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/AMagicRake/toolkit"
 )
 
+const uploadDir = "./uploads"
+
+// maxUploadSize is the most a whole upload request can be, files and form fields together
+const maxUploadSize = 1024 * 1024 * 1024
+
+var tools = toolkit.Tools{
+	MaxFileSize:    maxUploadSize,
+	AllowedTypes:   []string{"image/jpeg", "image/png", "image/gif"},
+	UploadMetadata: &toolkit.SidecarStore{Dir: uploadDir},
+}
+
+// uploadedFile is what the upload endpoints return for each file
+type uploadedFile struct {
+	OriginalFileName string `json:"original_file_name"`
+	NewFileName      string `json:"new_file_name"`
+	FileSize         int64  `json:"file_size"`
+	ContentType      string `json:"content_type"`
+	DownloadURL      string `json:"download_url"`
+}
+
 func main() {
 
 	mux := routes()
@@ -23,55 +45,101 @@ func main() {
 func routes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("."))))
+	// only the page itself is served, not the source or the uploads folder
+	mux.Handle("/", &toolkit.StaticFiles{
+		Root:         ".",
+		AllowedPaths: []string{"/index.html"},
+		CacheControl: "no-cache",
+	})
 	mux.HandleFunc("/upload", uploadFiles)
 	mux.HandleFunc("/upload-one", uploadOneFile)
+	mux.HandleFunc("GET /download/{name}", downloadFile)
 
 	return mux
 }
 
 func uploadFiles(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		_ = tools.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
 		return
 	}
 
-	t := toolkit.Tools{
-		MaxFileSize:  1024 * 1024 * 1024,
-		AllowedTypes: []string{"image/jpeg", "image/png", "image/gif"},
-	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 
-	files, err := t.UploadFiles(r, "./uploads")
+	files, err := tools.UploadFiles(r, uploadDir)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		uploadError(w, err)
 		return
 	}
 
-	out := ""
+	out := make([]uploadedFile, 0, len(files))
 	for _, item := range files {
-		out += fmt.Sprintf("Uploaded %s to the uploads folder, renamed to %s", item.OriginalFileName, item.NewFileName)
+		out = append(out, newUploadedFile(item))
 	}
 
-	_, _ = w.Write([]byte(out))
+	_ = tools.WriteJSON(w, http.StatusCreated, toolkit.JSONResponse{
+		Message: fmt.Sprintf("Uploaded %d files", len(out)),
+		Data:    out,
+	})
 }
 
 func uploadOneFile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		_ = tools.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
 		return
 	}
 
-	t := toolkit.Tools{
-		MaxFileSize:  1024 * 1024 * 1024,
-		AllowedTypes: []string{"image/jpeg", "image/png", "image/gif"},
-	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 
-	f, err := t.UploadOneFIle(r, "./uploads")
+	f, err := tools.UploadOneFIle(r, uploadDir)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		uploadError(w, err)
 		return
 	}
 
-	_, _ = w.Write([]byte(fmt.Sprintf("Uploaded 1 file, %s, to the uploads folder", f.OriginalFileName)))
+	_ = tools.WriteJSON(w, http.StatusCreated, toolkit.JSONResponse{
+		Message: fmt.Sprintf("Uploaded %s", f.OriginalFileName),
+		Data:    newUploadedFile(f),
+	})
+}
 
+func downloadFile(w http.ResponseWriter, r *http.Request) {
+	// the original file name is looked up from the metadata
+	tools.DownloadStaticFile(w, r, uploadDir, r.PathValue("name"), "")
+}
+
+func newUploadedFile(f *toolkit.UploadedFile) uploadedFile {
+	return uploadedFile{
+		OriginalFileName: f.OriginalFileName,
+		NewFileName:      f.NewFileName,
+		FileSize:         f.FileSize,
+		ContentType:      f.ContentType,
+		DownloadURL:      "/download/" + url.PathEscape(f.NewFileName),
+	}
+}
+
+// uploadError sends the JSON error for an error from UploadFiles. Problems with the request are
+// explained to the client, anything else is logged and reported as a server error without details
+func uploadError(w http.ResponseWriter, err error) {
+	status := uploadErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Println("upload failed:", err)
+		err = errors.New("the upload could not be saved")
+	}
+
+	_ = tools.ErrorJSON(w, err, status)
+}
+
+// uploadErrorStatus picks the status code for an error from UploadFiles
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, toolkit.ErrFileTooBig), errors.Is(err, toolkit.ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, toolkit.ErrFileTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, toolkit.ErrNoFile), errors.Is(err, toolkit.ErrInvalidUpload), errors.Is(err, toolkit.ErrInvalidPath):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
 }
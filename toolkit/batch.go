@@ -0,0 +1,217 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBatcherClosed is returned when adding to a Batcher that has been closed
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// BatchError reports a batch that could not be pushed. Items holds the JSON of every item in the
+// batch so they can be logged or pushed again
+type BatchError struct {
+	Items []json.RawMessage
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to push batch of %d items: %s", len(e.Items), e.Err.Error())
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Batcher collects items and pushes them to a remote server as a single JSON array once MaxItems
+// items have been added, the array would grow past MaxBytes, or Interval has passed since the first
+// item of the batch was added. Batches sent in the background report failures to OnError
+type Batcher struct {
+	// Tools makes the remote calls, so its retry, circuit breaker and rate limiting settings apply
+	Tools *Tools
+	// Request is used for every batch. Its Data is replaced by the batch
+	Request RemoteRequest
+	// MaxItems is the most items sent in one batch. Defaults to 100
+	MaxItems int
+	// MaxBytes is the largest JSON array sent in one batch. Defaults to 1MB
+	MaxBytes int
+	// Interval is the longest an item waits before its batch is sent. Defaults to 5s
+	Interval time.Duration
+	// OnError is called when a batch sent in the background fails
+	OnError func(err *BatchError)
+
+	mu     sync.Mutex
+	items  []json.RawMessage
+	size   int
+	timer  *time.Timer
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Add queues an item for the next batch. The item is marshalled straight away, so later changes to it
+// have no effect. Filling a batch sends it in the background
+func (b *Batcher) Add(item interface{}) error {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	maxItems, maxBytes, interval := b.limits()
+
+	// an item on its own still needs room for the brackets around the array
+	if len(raw)+2 > maxBytes {
+		return fmt.Errorf("item must not be larger than %d bytes", maxBytes-2)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBatcherClosed
+	}
+
+	if len(b.items) > 0 && b.size+1+len(raw) > maxBytes {
+		b.sendAsync(b.take())
+	}
+
+	if len(b.items) == 0 {
+		b.size = 2
+		b.timer = time.AfterFunc(interval, b.flushAsync)
+	} else {
+		b.size++
+	}
+
+	b.items = append(b.items, raw)
+	b.size += len(raw)
+
+	if len(b.items) >= maxItems {
+		b.sendAsync(b.take())
+	}
+
+	return nil
+}
+
+// Flush sends whatever is waiting straight away and returns the error, if any, rather than
+// passing it to OnError
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	items := b.take()
+	b.mu.Unlock()
+
+	return b.send(ctx, items)
+}
+
+// Close stops the batcher accepting items, sends what is left and waits for batches already being
+// sent in the background, giving up when ctx is done
+func (b *Batcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	items := b.take()
+	b.mu.Unlock()
+
+	err := b.send(ctx, items)
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	return err
+}
+
+func (b *Batcher) limits() (maxItems, maxBytes int, interval time.Duration) {
+	maxItems, maxBytes, interval = 100, 1024*1024, 5*time.Second
+	if b.MaxItems > 0 {
+		maxItems = b.MaxItems
+	}
+	if b.MaxBytes > 0 {
+		maxBytes = b.MaxBytes
+	}
+	if b.Interval > 0 {
+		interval = b.Interval
+	}
+	return maxItems, maxBytes, interval
+}
+
+// take removes the current batch. b.mu must be held
+func (b *Batcher) take() []json.RawMessage {
+	items := b.items
+	b.items = nil
+	b.size = 0
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	return items
+}
+
+// flushAsync is called by the timer once a batch has waited for Interval
+func (b *Batcher) flushAsync() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sendAsync(b.take())
+}
+
+// sendAsync sends a batch in the background. b.mu must be held so Close can't miss it
+func (b *Batcher) sendAsync(items []json.RawMessage) {
+	if len(items) == 0 {
+		return
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		var batchErr *BatchError
+		if err := b.send(context.Background(), items); errors.As(err, &batchErr) && b.OnError != nil {
+			b.OnError(batchErr)
+		}
+	}()
+}
+
+func (b *Batcher) send(ctx context.Context, items []json.RawMessage) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	var payload bytes.Buffer
+	payload.WriteByte('[')
+	for i, item := range items {
+		if i > 0 {
+			payload.WriteByte(',')
+		}
+		payload.Write(item)
+	}
+	payload.WriteByte(']')
+
+	req := b.Request
+	req.Data = json.RawMessage(payload.Bytes())
+
+	tools := b.Tools
+	if tools == nil {
+		tools = &Tools{}
+	}
+
+	if _, err := tools.CallRemoteJSON(ctx, req, nil); err != nil {
+		return &BatchError{Items: items, Err: err}
+	}
+
+	return nil
+}
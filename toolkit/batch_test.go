@@ -0,0 +1,160 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchServer records the size of every batch it receives
+type batchServer struct {
+	mu      sync.Mutex
+	batches [][]int
+	status  int
+}
+
+func (s *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var batch []int
+	_ = json.NewDecoder(r.Body).Decode(&batch)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, batch)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+	}
+}
+
+func (s *batchServer) received() [][]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([][]int(nil), s.batches...)
+}
+
+func TestBatcher_Thresholds(t *testing.T) {
+	var batchTests = []struct {
+		name     string
+		maxItems int
+		maxBytes int
+		items    int
+		expected []int
+	}{
+		{name: "max items", maxItems: 3, items: 7, expected: []int{3, 3, 1}},
+		{name: "max bytes", maxBytes: 8, items: 7, expected: []int{3, 3, 1}},
+		{name: "everything on close", items: 5, expected: []int{5}},
+	}
+
+	for _, e := range batchTests {
+		bs := &batchServer{}
+		srv := httptest.NewServer(bs)
+
+		b := &Batcher{Request: RemoteRequest{URL: srv.URL}, MaxItems: e.maxItems, MaxBytes: e.maxBytes}
+
+		for i := 0; i < e.items; i++ {
+			if err := b.Add(i); err != nil {
+				t.Errorf("%s: error adding item: %s", e.name, err)
+			}
+		}
+
+		if err := b.Close(context.Background()); err != nil {
+			t.Errorf("%s: error closing: %s", e.name, err)
+		}
+		srv.Close()
+
+		// background batches can arrive in any order, so only compare the sizes and the total
+		batches := bs.received()
+		total := 0
+		sizes := map[int]int{}
+		for _, batch := range batches {
+			total += len(batch)
+			sizes[len(batch)]++
+		}
+		for _, size := range e.expected {
+			sizes[size]--
+		}
+
+		if total != e.items || len(batches) != len(e.expected) {
+			t.Errorf("%s: expected batches of %v but got %v", e.name, e.expected, batches)
+			continue
+		}
+		for size, n := range sizes {
+			if n != 0 {
+				t.Errorf("%s: expected batches of %v but got %v (size %d)", e.name, e.expected, batches, size)
+				break
+			}
+		}
+	}
+}
+
+func TestBatcher_Interval(t *testing.T) {
+	bs := &batchServer{}
+	srv := httptest.NewServer(bs)
+	defer srv.Close()
+
+	b := &Batcher{Request: RemoteRequest{URL: srv.URL}, Interval: 20 * time.Millisecond}
+	defer b.Close(context.Background())
+
+	_ = b.Add(1)
+	_ = b.Add(2)
+
+	sent := waitFor(t, time.Second, func() bool {
+		return len(bs.received()) == 1
+	})
+	if !sent {
+		t.Fatal("batch was not sent after the interval")
+	}
+
+	if batch := bs.received()[0]; len(batch) != 2 || batch[0] != 1 || batch[1] != 2 {
+		t.Errorf("wrong batch sent: %v", batch)
+	}
+}
+
+func TestBatcher_Errors(t *testing.T) {
+	bs := &batchServer{status: http.StatusBadRequest}
+	srv := httptest.NewServer(bs)
+	defer srv.Close()
+
+	reported := make(chan *BatchError, 1)
+	b := &Batcher{
+		Request:  RemoteRequest{URL: srv.URL},
+		MaxItems: 2,
+		MaxBytes: 10,
+		OnError: func(err *BatchError) {
+			reported <- err
+		},
+	}
+
+	if err := b.Add("this item is far too big"); err == nil {
+		t.Error("expected an error adding an item larger than MaxBytes")
+	}
+
+	_ = b.Add(1)
+	_ = b.Add(2)
+
+	select {
+	case err := <-reported:
+		var remoteErr *RemoteError
+		if len(err.Items) != 2 || !errors.As(err, &remoteErr) || remoteErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("wrong batch error reported: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failed batch was not reported")
+	}
+
+	_ = b.Add(3)
+	if err := b.Flush(context.Background()); err == nil {
+		t.Error("expected Flush to return the error")
+	}
+
+	_ = b.Close(context.Background())
+	if err := b.Add(4); !errors.Is(err, ErrBatcherClosed) {
+		t.Errorf("expected ErrBatcherClosed but got %v", err)
+	}
+}
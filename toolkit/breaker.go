@@ -0,0 +1,308 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CallRemote, without contacting the server, while the circuit
+// breaker for a host is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of the circuit breaker for a single host
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every request until OpenTimeout has passed
+	CircuitOpen
+	// CircuitHalfOpen lets a few trial requests through to see if the host has recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker keeps a separate circuit for every host called through CallRemote. After
+// FailureThreshold failures in a row the circuit opens and calls fail straight away with
+// ErrCircuitOpen. Once OpenTimeout has passed a trial request is let through, which closes the
+// circuit again if it succeeds
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit. Defaults to 5
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before trying again. Defaults to 30s
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of trial requests allowed while half open. Defaults to 1
+	HalfOpenRequests int
+	// IsFailure decides whether a call counts as a failure. Defaults to network errors and 5xx responses
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called whenever the circuit for a host changes state
+	OnStateChange func(host string, from, to CircuitState)
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	inFlight int
+	// generation goes up on every change of state, so results from requests let through in an
+	// earlier state can be told apart
+	generation uint64
+}
+
+// setState moves c to state, starting a new generation if that's a change
+func (c *circuit) setState(state CircuitState) {
+	if c.state != state {
+		c.state = state
+		c.generation++
+	}
+}
+
+// State returns the current state of the circuit for host
+func (cb *CircuitBreaker) State(host string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c, ok := cb.hosts[host]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// allow reports whether a request to host may go ahead, returning the generation of the circuit
+// which has to be passed to record with the request's outcome
+func (cb *CircuitBreaker) allow(host string) (uint64, error) {
+	cb.mu.Lock()
+
+	c := cb.circuit(host)
+	from := c.state
+
+	if c.state == CircuitOpen {
+		if time.Since(c.openedAt) < cb.openTimeout() {
+			cb.mu.Unlock()
+			return 0, ErrCircuitOpen
+		}
+
+		c.setState(CircuitHalfOpen)
+		c.inFlight = 0
+	}
+
+	if c.state == CircuitHalfOpen {
+		halfOpenRequests := 1
+		if cb.HalfOpenRequests > 0 {
+			halfOpenRequests = cb.HalfOpenRequests
+		}
+
+		if c.inFlight >= halfOpenRequests {
+			cb.mu.Unlock()
+			cb.changed(host, from, c.state)
+			return 0, ErrCircuitOpen
+		}
+		c.inFlight++
+	}
+
+	to, generation := c.state, c.generation
+	cb.mu.Unlock()
+	cb.changed(host, from, to)
+
+	return generation, nil
+}
+
+// record updates the circuit for host with the outcome of a request that allow let through in
+// generation. A request which finishes after the circuit has changed state is ignored, so a slow
+// request sent while closed can't close an open circuit or decide a half open trial.
+// A cancelled request is the caller's doing rather than the host's, so it says nothing about the host's
+// health. It only gives back its half open slot, leaving the state and failure count alone
+func (cb *CircuitBreaker) record(host string, generation uint64, response *http.Response, err error) {
+	cancelled := errors.Is(err, context.Canceled)
+
+	isFailure := defaultIsFailure
+	if cb.IsFailure != nil {
+		isFailure = cb.IsFailure
+	}
+	failed := !cancelled && isFailure(response, err)
+
+	cb.mu.Lock()
+
+	c := cb.circuit(host)
+	from := c.state
+
+	if c.generation != generation {
+		cb.mu.Unlock()
+		return
+	}
+
+	if c.state == CircuitHalfOpen && c.inFlight > 0 {
+		c.inFlight--
+	}
+
+	if cancelled {
+		cb.mu.Unlock()
+		return
+	}
+
+	threshold := 5
+	if cb.FailureThreshold > 0 {
+		threshold = cb.FailureThreshold
+	}
+
+	switch {
+	case !failed:
+		c.failures = 0
+		c.setState(CircuitClosed)
+	case c.state == CircuitHalfOpen:
+		c.setState(CircuitOpen)
+		c.openedAt = time.Now()
+	default:
+		c.failures++
+		if c.failures >= threshold {
+			c.setState(CircuitOpen)
+			c.openedAt = time.Now()
+		}
+	}
+
+	to := c.state
+	cb.mu.Unlock()
+	cb.changed(host, from, to)
+}
+
+// retryAt returns when the circuit for host will next let a request through. A half open circuit
+// with its trial slots taken could free them at any time, so that's now
+func (cb *CircuitBreaker) retryAt(host string) time.Time {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c, ok := cb.hosts[host]; ok && c.state == CircuitOpen {
+		return c.openedAt.Add(cb.openTimeout())
+	}
+	return time.Now()
+}
+
+func (cb *CircuitBreaker) openTimeout() time.Duration {
+	if cb.OpenTimeout > 0 {
+		return cb.OpenTimeout
+	}
+	return 30 * time.Second
+}
+
+// circuit returns the circuit for host, creating it if needed. cb.mu must be held
+func (cb *CircuitBreaker) circuit(host string) *circuit {
+	if cb.hosts == nil {
+		cb.hosts = make(map[string]*circuit)
+	}
+
+	c, ok := cb.hosts[host]
+	if !ok {
+		c = &circuit{}
+		cb.hosts[host] = c
+	}
+	return c
+}
+
+// changed calls OnStateChange, outside of the lock so the callback can inspect the breaker
+func (cb *CircuitBreaker) changed(host string, from, to CircuitState) {
+	if from != to && cb.OnStateChange != nil {
+		cb.OnStateChange(host, from, to)
+	}
+}
+
+// defaultIsFailure counts network errors and server errors as failures
+func defaultIsFailure(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return response.StatusCode >= 500
+}
+
+// RateLimiter is a token bucket limiting how often CallRemote contacts each host. Every host gets its
+// own bucket holding up to Burst tokens, refilled at Rate tokens a second
+type RateLimiter struct {
+	// Rate is the number of requests allowed per second
+	Rate float64
+	// Burst is the number of requests that can be made at once. Defaults to 1
+	Burst int
+	// OnThrottle is called whenever a request to host has to wait before it can be sent
+	OnThrottle func(host string, wait time.Duration)
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Wait blocks until a request to host is allowed or ctx is done. A limiter with no Rate never waits
+func (rl *RateLimiter) Wait(ctx context.Context, host string) error {
+	if rl.Rate <= 0 {
+		return nil
+	}
+
+	burst := 1.0
+	if rl.Burst > 0 {
+		burst = float64(rl.Burst)
+	}
+
+	rl.mu.Lock()
+	if rl.buckets == nil {
+		rl.buckets = make(map[string]*bucket)
+	}
+
+	now := time.Now()
+	b, ok := rl.buckets[host]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		rl.buckets[host] = b
+	}
+
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rl.Rate)
+	b.last = now
+
+	// take the token now, even if it means going into debt, so waiting callers queue up in order
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / rl.Rate * float64(time.Second))
+	}
+	rl.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	if rl.OnThrottle != nil {
+		rl.OnThrottle(host, wait)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		// hand the token back since it was never used
+		rl.mu.Lock()
+		b.tokens++
+		rl.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
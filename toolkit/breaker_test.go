@@ -0,0 +1,250 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTools_CircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	host := u.Host
+
+	var mu sync.Mutex
+	var changes []string
+
+	breaker := &CircuitBreaker{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		OnStateChange: func(h string, from, to CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	}
+
+	tool := &Tools{CircuitBreaker: breaker}
+	call := func() error {
+		response, err := tool.CallRemote(context.Background(), RemoteRequest{URL: srv.URL, Data: "foo"})
+		if err == nil {
+			response.Body.Close()
+		}
+		return err
+	}
+
+	// two failures open the circuit
+	_ = call()
+	_ = call()
+	if breaker.State(host) != CircuitOpen {
+		t.Fatalf("expected circuit to be open, got %s", breaker.State(host))
+	}
+
+	// while open the server is never called
+	if err := call(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen but got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 calls to the server but got %d", calls.Load())
+	}
+
+	// after the timeout a failing trial request opens it again
+	time.Sleep(60 * time.Millisecond)
+	_ = call()
+	if breaker.State(host) != CircuitOpen {
+		t.Errorf("expected circuit to open again after failed trial, got %s", breaker.State(host))
+	}
+
+	// and a successful one closes it
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if err := call(); err != nil {
+		t.Errorf("expected trial request to succeed but got %v", err)
+	}
+	if breaker.State(host) != CircuitClosed {
+		t.Errorf("expected circuit to be closed, got %s", breaker.State(host))
+	}
+
+	expected := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != len(expected) {
+		t.Fatalf("expected state changes %v but got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected state changes %v but got %v", expected, changes)
+			break
+		}
+	}
+}
+
+func TestTools_CircuitBreakerStopsRetries(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	tool := &Tools{
+		CircuitBreaker: &CircuitBreaker{FailureThreshold: 2},
+		RemoteRetry:    &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond},
+	}
+
+	_, err := tool.CallRemote(context.Background(), RemoteRequest{URL: srv.URL, Data: "foo"})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen but got %v", err)
+	}
+
+	if calls.Load() != 2 {
+		t.Errorf("expected retries to stop once the circuit opened, got %d calls", calls.Load())
+	}
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	var throttled atomic.Int32
+	limiter := &RateLimiter{Rate: 100, Burst: 2, OnThrottle: func(host string, wait time.Duration) {
+		throttled.Add(1)
+	}}
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := limiter.Wait(context.Background(), "example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first two go straight through, the other four wait 10ms each
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("expected requests to be throttled, took %s", elapsed)
+	}
+
+	if throttled.Load() != 4 {
+		t.Errorf("expected 4 throttled requests but got %d", throttled.Load())
+	}
+
+	// other hosts have their own bucket
+	start = time.Now()
+	_ = limiter.Wait(context.Background(), "example.org")
+	if time.Since(start) > 5*time.Millisecond {
+		t.Error("expected a different host not to be throttled")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx, "example.com"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context cancelled but got %v", err)
+	}
+}
+
+func TestCircuitBreaker_CancelledIsNeutral(t *testing.T) {
+	cb := &CircuitBreaker{FailureThreshold: 2, OpenTimeout: 10 * time.Millisecond}
+	failure := &http.Response{StatusCode: http.StatusBadGateway}
+	cancelled := fmt.Errorf("calling host: %w", context.Canceled)
+
+	// a cancelled request between failures doesn't reset the count
+	gen, _ := cb.allow("host")
+	cb.record("host", gen, failure, nil)
+	gen, _ = cb.allow("host")
+	cb.record("host", gen, nil, cancelled)
+	gen, _ = cb.allow("host")
+	cb.record("host", gen, failure, nil)
+
+	if state := cb.State("host"); state != CircuitOpen {
+		t.Fatalf("expected the circuit to open after 2 failures, got %s", state)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// a cancelled trial request doesn't close the circuit, but does free up the trial slot
+	gen, err := cb.allow("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb.record("host", gen, nil, cancelled)
+
+	if state := cb.State("host"); state != CircuitHalfOpen {
+		t.Errorf("expected the circuit to stay half open after a cancelled trial, got %s", state)
+	}
+
+	gen, err = cb.allow("host")
+	if err != nil {
+		t.Errorf("expected another trial request to be allowed, got %v", err)
+	}
+	cb.record("host", gen, &http.Response{StatusCode: http.StatusOK}, nil)
+
+	if state := cb.State("host"); state != CircuitClosed {
+		t.Errorf("expected a successful trial to close the circuit, got %s", state)
+	}
+}
+
+func TestCircuitBreaker_IgnoresStragglers(t *testing.T) {
+	cb := &CircuitBreaker{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond}
+	failure := &http.Response{StatusCode: http.StatusBadGateway}
+	success := &http.Response{StatusCode: http.StatusOK}
+
+	// two slow requests are let through while closed, then another one opens the circuit
+	slowSuccess, _ := cb.allow("host")
+	slowFailure, _ := cb.allow("host")
+	gen, _ := cb.allow("host")
+	cb.record("host", gen, failure, nil)
+
+	cb.record("host", slowSuccess, success, nil)
+	if state := cb.State("host"); state != CircuitOpen {
+		t.Fatalf("a late success closed the open circuit, got %s", state)
+	}
+
+	cb.mu.Lock()
+	openedAt := cb.hosts["host"].openedAt
+	cb.mu.Unlock()
+
+	cb.record("host", slowFailure, failure, nil)
+
+	cb.mu.Lock()
+	extended := !cb.hosts["host"].openedAt.Equal(openedAt)
+	cb.mu.Unlock()
+	if extended {
+		t.Error("a late failure extended the open window")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// once half open, the stragglers still can't take the trial slot or decide the trial
+	trial, err := cb.allow("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb.record("host", slowSuccess, success, nil)
+	if state := cb.State("host"); state != CircuitHalfOpen {
+		t.Errorf("a late success decided the trial, got %s", state)
+	}
+
+	if _, err := cb.allow("host"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("a late result freed the trial slot, got %v", err)
+	}
+
+	cb.record("host", trial, success, nil)
+	if state := cb.State("host"); state != CircuitClosed {
+		t.Errorf("expected the trial to close the circuit, got %s", state)
+	}
+}
@@ -0,0 +1,330 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// compressedBody closes both the decompressor and the request body it reads from
+type compressedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *compressedBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		if cErr := c.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+// decodedRequestBody replaces r.Body with a reader that removes any gzip or deflate Content-Encoding.
+// The limit is applied to the decompressed stream, so a small compressed body can't expand into
+// something larger than maxBytes
+func decodedRequestBody(w http.ResponseWriter, r *http.Request, maxBytes int) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+	var body io.ReadCloser
+	switch encoding {
+	case "", "identity":
+		body = r.Body
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+		if err != nil {
+			return errors.New("body is not valid gzip data")
+		}
+		body = &compressedBody{Reader: zr, closers: []io.Closer{zr, r.Body}}
+	case "deflate":
+		zr, err := newDeflateReader(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+		if err != nil {
+			return errors.New("body is not valid deflate data")
+		}
+		body = &compressedBody{Reader: zr, closers: []io.Closer{zr, r.Body}}
+	default:
+		return fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	if encoding != "" && encoding != "identity" {
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+	}
+
+	r.Body = http.MaxBytesReader(w, body, int64(maxBytes))
+	return nil
+}
+
+// newDeflateReader reads zlib wrapped data, which is what the HTTP spec calls deflate, but falls
+// back to raw deflate since plenty of clients send that instead
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+
+	return flate.NewReader(br), nil
+}
+
+// gzipPayload compresses an outgoing request body
+func gzipPayload(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// defaultCompressibleTypes are used by Compress when CompressibleTypes is empty. Any type ending
+// in +json or +xml is also treated as compressible
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-ndjson",
+	"image/svg+xml",
+}
+
+// Compress is middleware which gzip or deflate compresses responses for clients that accept it.
+// Only responses of at least CompressMinSize bytes with one of the CompressibleTypes are compressed,
+// and range requests are passed through untouched so DownloadStaticFile can still serve partial content
+func (t *Tools) Compress(next http.Handler) http.Handler {
+	minSize := 1024
+	if t.CompressMinSize != 0 {
+		minSize = t.CompressMinSize
+	}
+
+	types := defaultCompressibleTypes
+	if len(t.CompressibleTypes) > 0 {
+		types = t.CompressibleTypes
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, types: types}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header, honouring q values. An
+// empty string means the response should not be compressed
+func negotiateEncoding(header string) string {
+	quality := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if _, err := fmt.Sscanf(v, "%g", &q); err != nil {
+				q = 0
+			}
+		}
+		quality[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range []string{"gzip", "deflate"} {
+		q, ok := quality[enc]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+// isCompressible reports whether contentType matches one of types. Entries ending in /* match a
+// whole family of types
+func isCompressible(contentType string, types []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+
+	if strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+
+	for _, x := range types {
+		x = strings.ToLower(x)
+		if prefix, ok := strings.CutSuffix(x, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == x {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether the response is big enough
+// and of the right type to be worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	types    []string
+
+	status  int
+	buf     []byte
+	decided bool
+	zw      io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.zw != nil {
+		return cw.zw.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide sends the headers and whatever has been buffered so far. When streaming is true the size
+// threshold is ignored, since a handler that flushes expects the response to be sent in pieces
+func (cw *compressWriter) decide(streaming bool) error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	compress := (streaming || len(cw.buf) >= cw.minSize) &&
+		h.Get("Content-Encoding") == "" &&
+		cw.status != http.StatusNoContent &&
+		cw.status != http.StatusNotModified &&
+		cw.status != http.StatusPartialContent &&
+		isCompressible(h.Get("Content-Type"), cw.types)
+
+	if compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+
+		if cw.encoding == "gzip" {
+			cw.zw = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			cw.zw = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.zw != nil {
+		_, err = cw.zw.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush implements http.Flusher so streaming handlers keep working behind Compress
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(true); err != nil {
+			return
+		}
+	}
+
+	if f, ok := cw.zw.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends anything still buffered and finishes the compressed stream
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			// nothing was written, so leave the response to the server
+			return nil
+		}
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+
+	if cw.zw != nil {
+		return cw.zw.Close()
+	}
+	return nil
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,284 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compressWith(t *testing.T, encoding, s string) []byte {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+
+	switch encoding {
+	case "gzip":
+		zw = gzip.NewWriter(&buf)
+	case "deflate":
+		zw = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		zw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return []byte(s)
+	}
+
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+var compressedJSONTests = []struct {
+	name          string
+	json          string
+	compressWith  string
+	encoding      string
+	errorExpected bool
+	maxSize       int
+}{
+	{name: "gzip", json: `{"foo": "bar"}`, compressWith: "gzip", encoding: "gzip"},
+	{name: "x-gzip", json: `{"foo": "bar"}`, compressWith: "gzip", encoding: "x-gzip"},
+	{name: "deflate", json: `{"foo": "bar"}`, compressWith: "deflate", encoding: "deflate"},
+	{name: "raw deflate", json: `{"foo": "bar"}`, compressWith: "raw-deflate", encoding: "Deflate"},
+	{name: "identity", json: `{"foo": "bar"}`, encoding: "identity"},
+	{name: "not really gzip", json: `{"foo": "bar"}`, encoding: "gzip", errorExpected: true},
+	{name: "unsupported encoding", json: `{"foo": "bar"}`, encoding: "br", errorExpected: true},
+	{name: "decompression bomb", json: `{"foo": "` + strings.Repeat("a", 1024*64) + `"}`, compressWith: "gzip", encoding: "gzip", maxSize: 1024, errorExpected: true},
+}
+
+func TestTools_ReadJSONCompressed(t *testing.T) {
+	for _, e := range compressedJSONTests {
+		tool := Tools{MaxJsonSize: e.maxSize}
+
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(compressWith(t, e.compressWith, e.json)))
+		req.Header.Set("Content-Encoding", e.encoding)
+		rr := httptest.NewRecorder()
+
+		var decoded struct {
+			Foo string `json:"foo"`
+		}
+
+		err := tool.ReadJSON(rr, req, &decoded)
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+
+		if !e.errorExpected {
+			if err != nil {
+				t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+			} else if decoded.Foo != "bar" {
+				t.Errorf("%s: wrong value decoded: %q", e.name, decoded.Foo)
+			}
+		}
+	}
+}
+
+func TestTools_ReadJSONStreamCompressed(t *testing.T) {
+	tool := Tools{}
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(compressWith(t, "gzip", "{\"foo\": \"a\"}\n{\"foo\": \"b\"}\n")))
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	count := 0
+	err := tool.ReadJSONStream(rr, req, func(index int, decode func(v interface{}) error) error {
+		count++
+		return decode(&struct {
+			Foo string `json:"foo"`
+		}{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 elements but got %d", count)
+	}
+}
+
+func TestTools_PushJSONToRemoteCompressed(t *testing.T) {
+	var received string
+	var encoding string
+
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		encoding = req.Header.Get("Content-Encoding")
+
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			t.Error("body was not gzipped:", err)
+		} else {
+			body, _ := io.ReadAll(zr)
+			received = string(body)
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewBufferString("ok")),
+			Header:     make(http.Header),
+		}
+	})
+
+	tool := &Tools{CompressRemoteJSON: true}
+
+	_, _, err := tool.PushJSONToRemote("http://example.com/some/path", map[string]string{"bar": "bar"}, client)
+	if err != nil {
+		t.Error("failed to call remote url: ", err)
+	}
+
+	if encoding != "gzip" {
+		t.Errorf("expected gzip content encoding but got %q", encoding)
+	}
+
+	if received != `{"bar":"bar"}` {
+		t.Errorf("wrong payload received: %s", received)
+	}
+}
+
+var compressTests = []struct {
+	name           string
+	acceptEncoding string
+	rangeHeader    string
+	contentType    string
+	size           int
+	expected       string
+}{
+	{name: "gzip", acceptEncoding: "gzip, deflate", contentType: "application/json", size: 4096, expected: "gzip"},
+	{name: "deflate preferred", acceptEncoding: "gzip;q=0.5, deflate", contentType: "text/html; charset=utf-8", size: 4096, expected: "deflate"},
+	{name: "wildcard", acceptEncoding: "*", contentType: "application/problem+json", size: 4096, expected: "gzip"},
+	{name: "gzip refused", acceptEncoding: "gzip;q=0", contentType: "application/json", size: 4096, expected: ""},
+	{name: "no accept encoding", acceptEncoding: "", contentType: "application/json", size: 4096, expected: ""},
+	{name: "too small", acceptEncoding: "gzip", contentType: "application/json", size: 100, expected: ""},
+	{name: "not compressible", acceptEncoding: "gzip", contentType: "image/png", size: 4096, expected: ""},
+	{name: "range request", acceptEncoding: "gzip", rangeHeader: "bytes=0-99", contentType: "text/plain", size: 4096, expected: ""},
+}
+
+func TestTools_Compress(t *testing.T) {
+	tool := &Tools{}
+
+	for _, e := range compressTests {
+		body := strings.Repeat("a", e.size)
+
+		handler := tool.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", e.contentType)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(body[:e.size/2]))
+			_, _ = w.Write([]byte(body[e.size/2:]))
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", e.acceptEncoding)
+		if e.rangeHeader != "" {
+			req.Header.Set("Range", e.rangeHeader)
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("%s: wrong status code %d", e.name, rr.Code)
+		}
+
+		if got := rr.Header().Get("Content-Encoding"); got != e.expected {
+			t.Errorf("%s: expected content encoding %q but got %q", e.name, e.expected, got)
+		}
+
+		var reader io.Reader = rr.Body
+		switch e.expected {
+		case "gzip":
+			reader, _ = gzip.NewReader(rr.Body)
+		case "deflate":
+			reader, _ = zlib.NewReader(rr.Body)
+		}
+
+		out, err := io.ReadAll(reader)
+		if err != nil {
+			t.Errorf("%s: failed to read body: %s", e.name, err)
+		}
+
+		if string(out) != body {
+			t.Errorf("%s: body was not returned intact, got %d bytes", e.name, len(out))
+		}
+	}
+}
+
+func TestTools_CompressWriteJSON(t *testing.T) {
+	tool := &Tools{CompressMinSize: 10}
+
+	handler := tool.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = tool.WriteJSON(w, http.StatusOK, JSONResponse{Message: strings.Repeat("foo", 100)})
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected the JSON response to be compressed")
+	}
+
+	if rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Error("expected Vary: Accept-Encoding to be set")
+	}
+
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload JSONResponse
+	if err := json.NewDecoder(zr).Decode(&payload); err != nil {
+		t.Fatal("received error when decoding JSON", err)
+	}
+
+	if payload.Message != strings.Repeat("foo", 100) {
+		t.Error("wrong message decoded")
+	}
+}
+
+func TestTools_CompressFlush(t *testing.T) {
+	tool := &Tools{}
+
+	handler := tool.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: one\n\n"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("data: two\n\n"))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if !rr.Flushed {
+		t.Error("expected the response to be flushed")
+	}
+
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected a flushed stream to be compressed")
+	}
+
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := io.ReadAll(zr)
+	if string(out) != "data: one\n\ndata: two\n\n" {
+		t.Errorf("wrong body: %q", out)
+	}
+}
@@ -0,0 +1,190 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Errors returned by the directory helpers
+var (
+	ErrNotDirectory = errors.New("path exists but is not a directory")
+	ErrOutsideBase  = errors.New("path is outside the base directory")
+)
+
+// DirOptions sets the permissions and owner of directories made by CreateDir. The zero value makes
+// directories with mode 0755 owned by the current user
+type DirOptions struct {
+	Mode os.FileMode
+	// Chown sets the owner of new directories to UID and GID, which usually needs root
+	Chown bool
+	UID   int
+	GID   int
+}
+
+// CreateDir creates dir and any missing parents with the mode and owner in opts. Unlike os.MkdirAll the
+// mode isn't reduced by the umask. Existing directories are left alone, and it is an error if something
+// other than a directory is already at dir
+func (t *Tools) CreateDir(dir string, opts ...DirOptions) error {
+	var o DirOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.Mode == 0 {
+		o.Mode = 0755
+	}
+
+	info, err := os.Stat(dir)
+	switch {
+	case err == nil && !info.IsDir():
+		return fmt.Errorf("%w: %s", ErrNotDirectory, dir)
+	case err == nil:
+		return nil
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	// remember which directories are new so only they get the mode and owner
+	var created []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		created = append(created, d)
+
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, o.Mode); err != nil {
+		return err
+	}
+
+	for _, d := range created {
+		if err := os.Chmod(d, o.Mode); err != nil {
+			return err
+		}
+
+		if o.Chown {
+			if err := os.Chown(d, o.UID, o.GID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// EnsureWritableDir checks that dir is a directory this process can create files in
+func (t *Tools) EnsureWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrNotDirectory, dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".writable-*")
+	if err != nil {
+		return fmt.Errorf("directory is not writable: %w", err)
+	}
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// EnsureEmptyDir makes sure dir is an empty directory, creating it if it doesn't exist and deleting
+// everything in it if it does
+func (t *Tools) EnsureEmptyDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	if filepath.Dir(abs) == abs {
+		return errors.New("refusing to empty the root directory")
+	}
+
+	if err := t.CreateDir(abs); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(abs, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveWithin deletes target and anything in it, but only if target is inside base once symlinks
+// are followed. base itself can't be removed. A target that doesn't exist isn't an error
+func (t *Tools) RemoveWithin(base, target string) error {
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return err
+	}
+
+	realBase, err = filepath.Abs(realBase)
+	if err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	// resolve the parent rather than target, so a symlink as target is removed rather than followed
+	parent, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	realTarget := filepath.Join(parent, filepath.Base(abs))
+	if !isWithin(realBase, realTarget) {
+		return fmt.Errorf("%w: %s", ErrOutsideBase, target)
+	}
+
+	return os.RemoveAll(realTarget)
+}
+
+// isWithin reports whether path is strictly inside base. Both must be clean absolute paths
+func isWithin(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// TempDir creates a new directory in parent, or the system temporary directory if parent is empty,
+// with a name made from pattern as in os.MkdirTemp. The returned function deletes the directory and
+// everything in it, and is safe to call more than once
+func (t *Tools) TempDir(parent, pattern string) (string, func() error, error) {
+	dir, err := os.MkdirTemp(parent, pattern)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cleanup := func() error {
+		return os.RemoveAll(dir)
+	}
+
+	return dir, cleanup, nil
+}
@@ -0,0 +1,195 @@
+package toolkit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestTools_CreateDir(t *testing.T) {
+	var tool Tools
+	base := t.TempDir()
+
+	dir := filepath.Join(base, "a", "b")
+	if err := tool.CreateDir(dir, DirOptions{Mode: 0700}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range []string{filepath.Join(base, "a"), dir} {
+		info, err := os.Stat(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != 0700 {
+			t.Errorf("%s: expected mode 0700 but got %o", d, info.Mode().Perm())
+		}
+	}
+
+	if err := tool.CreateDir(dir); err != nil {
+		t.Errorf("existing directory should not be an error: %s", err)
+	}
+
+	file := filepath.Join(base, "file")
+	_ = os.WriteFile(file, []byte("foo"), 0644)
+
+	if err := tool.CreateDir(file); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory but got %v", err)
+	}
+
+	if err := tool.CreateDirIfNotExists(file); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory from CreateDirIfNotExists but got %v", err)
+	}
+
+	if err := tool.CreateDir(filepath.Join(file, "child")); err == nil {
+		t.Error("expected an error creating a directory under a file")
+	}
+
+	// chown to the current user, which doesn't need root. Windows has no chown
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	owned := filepath.Join(base, "owned")
+	if err := tool.CreateDir(owned, DirOptions{Chown: true, UID: os.Getuid(), GID: os.Getgid()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTools_EnsureWritableDir(t *testing.T) {
+	var tool Tools
+	dir := t.TempDir()
+
+	if err := tool.EnsureWritableDir(dir); err != nil {
+		t.Errorf("temp dir should be writable: %s", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("check left %d files behind", len(entries))
+	}
+
+	if err := tool.EnsureWritableDir(filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist but got %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	_ = os.WriteFile(file, []byte("foo"), 0644)
+
+	if err := tool.EnsureWritableDir(file); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory but got %v", err)
+	}
+
+	if os.Getuid() != 0 {
+		readOnly := filepath.Join(dir, "read-only")
+		_ = os.Mkdir(readOnly, 0500)
+
+		if err := tool.EnsureWritableDir(readOnly); err == nil {
+			t.Error("expected an error for a read only directory")
+		}
+	}
+}
+
+func TestTools_EnsureEmptyDir(t *testing.T) {
+	var tool Tools
+	dir := filepath.Join(t.TempDir(), "empty")
+
+	if err := tool.EnsureEmptyDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = os.MkdirAll(filepath.Join(dir, "sub", "deeper"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "file"), []byte("foo"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, ".hidden"), []byte("foo"), 0644)
+
+	if err := tool.EnsureEmptyDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the directory to be empty, found %d entries", len(entries))
+	}
+
+	if err := tool.EnsureEmptyDir("/"); err == nil {
+		t.Error("expected an error emptying the root directory")
+	}
+}
+
+func TestTools_RemoveWithin(t *testing.T) {
+	var tool Tools
+	root := t.TempDir()
+	base := filepath.Join(root, "base")
+	outside := filepath.Join(root, "outside")
+
+	_ = os.MkdirAll(filepath.Join(base, "sub", "deeper"), 0755)
+	_ = os.MkdirAll(outside, 0755)
+	_ = os.WriteFile(filepath.Join(outside, "keep"), []byte("foo"), 0644)
+	_ = os.Symlink(outside, filepath.Join(base, "link"))
+
+	var removeTests = []struct {
+		name          string
+		target        string
+		expectedError error
+		errorExpected bool
+	}{
+		{name: "inside", target: filepath.Join(base, "sub")},
+		{name: "missing", target: filepath.Join(base, "missing")},
+		{name: "base itself", target: base, expectedError: ErrOutsideBase},
+		{name: "parent", target: filepath.Join(base, ".."), expectedError: ErrOutsideBase},
+		{name: "dot dot", target: filepath.Join(base, "sub", "..", "..", "outside"), expectedError: ErrOutsideBase},
+		{name: "through symlink", target: filepath.Join(base, "link", "keep"), expectedError: ErrOutsideBase},
+		{name: "symlink itself", target: filepath.Join(base, "link")},
+	}
+
+	for _, e := range removeTests {
+		err := tool.RemoveWithin(base, e.target)
+
+		if e.expectedError == nil && err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected error %q but got %v", e.name, e.expectedError, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "sub")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("directory inside base was not removed")
+	}
+
+	if _, err := os.Lstat(filepath.Join(base, "link")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("symlink inside base was not removed")
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "keep")); err != nil {
+		t.Error("file outside base was removed")
+	}
+}
+
+func TestTools_TempDir(t *testing.T) {
+	var tool Tools
+
+	dir, cleanup, err := tool.TempDir(t.TempDir(), "upload-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(dir)[:7] != "upload-" {
+		t.Errorf("wrong name: %s", dir)
+	}
+
+	_ = os.WriteFile(filepath.Join(dir, "file"), []byte("foo"), 0644)
+
+	if err := cleanup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Error("temp dir was not removed")
+	}
+
+	if err := cleanup(); err != nil {
+		t.Errorf("second cleanup should not be an error: %s", err)
+	}
+}
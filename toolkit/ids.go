@@ -0,0 +1,308 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDScheme selects the kind of identifier made by NewID
+type IDScheme string
+
+const (
+	// IDRandomString is 25 characters from RandomString, which is what UploadFiles has always used
+	IDRandomString IDScheme = ""
+	// IDUUIDv4 is a random RFC 9562 UUID
+	IDUUIDv4 IDScheme = "uuidv4"
+	// IDUUIDv7 is a time ordered RFC 9562 UUID
+	IDUUIDv7 IDScheme = "uuidv7"
+	// IDULID is a time ordered, Crockford base32 encoded ULID
+	IDULID IDScheme = "ulid"
+	// IDNanoID is a 21 character URL safe NanoID
+	IDNanoID IDScheme = "nanoid"
+)
+
+// ErrInvalidID is returned when parsing an identifier that isn't well formed
+var ErrInvalidID = errors.New("invalid identifier")
+
+// NewID returns a new identifier using the given scheme
+func (t *Tools) NewID(scheme IDScheme) (string, error) {
+	switch scheme {
+	case IDRandomString:
+		return t.RandomStringFrom(25, t.randomStringAlphabet())
+	case IDUUIDv4:
+		return t.NewUUIDv4()
+	case IDUUIDv7:
+		return t.NewUUIDv7()
+	case IDULID:
+		return t.NewULID()
+	case IDNanoID:
+		return t.NewNanoID()
+	default:
+		return "", fmt.Errorf("unknown ID scheme %q", scheme)
+	}
+}
+
+// UUID is a 128 bit RFC 9562 universally unique identifier
+type UUID [16]byte
+
+// String returns the UUID in its canonical, lower case, hyphenated form
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// Version returns the version number held in the UUID
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Time returns the time a version 7 UUID was made. ok is false for any other version
+func (u UUID) Time() (tm time.Time, ok bool) {
+	if u.Version() != 7 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(uint48(u[0:6]))), true
+}
+
+// NewUUIDv4 returns a random version 4 UUID
+func (t *Tools) NewUUIDv4() (string, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", fmt.Errorf("unable to read random data: %w", err)
+	}
+
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+
+	return u.String(), nil
+}
+
+// NewUUIDv7 returns a version 7 UUID, which starts with a millisecond timestamp so UUIDs sort in the
+// order they were made. UUIDs made in the same millisecond by this process use a counter so they
+// still sort correctly
+func (t *Tools) NewUUIDv7() (string, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", fmt.Errorf("unable to read random data: %w", err)
+	}
+
+	ms, counter := idClock.nextV7(uint16(u[6])<<8 | uint16(u[7]))
+
+	putUint48(u[0:6], uint64(ms))
+	u[6] = 0x70 | byte(counter>>8)&0x0f
+	u[7] = byte(counter)
+	u[8] = u[8]&0x3f | 0x80
+
+	return u.String(), nil
+}
+
+// ParseUUID parses a UUID in its canonical hyphenated form, in either case
+func (t *Tools) ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, ErrInvalidID
+	}
+
+	digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return u, ErrInvalidID
+	}
+
+	return u, nil
+}
+
+// ULID is a 128 bit universally unique lexicographically sortable identifier
+type ULID [16]byte
+
+// crockford is the Crockford base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// String returns the ULID as 26 Crockford base32 characters
+func (u ULID) String() string {
+	// 26 characters hold 130 bits, so the encoding starts with 2 padding bits
+	var buf [26]byte
+	for i := range buf {
+		var v byte
+		for b := i * 5; b < i*5+5; b++ {
+			v <<= 1
+			if d := b - 2; d >= 0 && u[d/8]&(0x80>>(d%8)) != 0 {
+				v |= 1
+			}
+		}
+		buf[i] = crockford[v]
+	}
+	return string(buf[:])
+}
+
+// Time returns the time the ULID was made
+func (u ULID) Time() time.Time {
+	return time.UnixMilli(int64(uint48(u[0:6])))
+}
+
+// NewULID returns a ULID, which starts with a millisecond timestamp so ULIDs sort in the order they
+// were made. ULIDs made in the same millisecond by this process increment the random part so they
+// still sort correctly
+func (t *Tools) NewULID() (string, error) {
+	var entropy [10]byte
+	if _, err := rand.Read(entropy[:]); err != nil {
+		return "", fmt.Errorf("unable to read random data: %w", err)
+	}
+
+	ms, entropy := idClock.nextULID(entropy)
+
+	var u ULID
+	putUint48(u[0:6], uint64(ms))
+	copy(u[6:], entropy[:])
+
+	return u.String(), nil
+}
+
+// ParseULID parses a ULID. Parsing is case insensitive and, as Crockford base32 allows, I and L are
+// read as 1 and O as 0
+func (t *Tools) ParseULID(s string) (ULID, error) {
+	var u ULID
+	s = strings.NewReplacer("I", "1", "i", "1", "L", "1", "l", "1", "O", "0", "o", "0").Replace(s)
+
+	// the first character only holds 3 bits, so anything above 7 would overflow
+	if len(s) != 26 || s[0] > '7' {
+		return u, ErrInvalidID
+	}
+
+	for i := 0; i < 26; i++ {
+		v := strings.IndexByte(crockford, upper(s[i]))
+		if v < 0 {
+			return u, ErrInvalidID
+		}
+
+		for b := 0; b < 5; b++ {
+			if d := i*5 + b - 2; d >= 0 && v&(0x10>>b) != 0 {
+				u[d/8] |= 0x80 >> (d % 8)
+			}
+		}
+	}
+
+	return u, nil
+}
+
+// NewNanoID returns a NanoID of size characters, 21 if no size is given, from the URL safe alphabet
+func (t *Tools) NewNanoID(size ...int) (string, error) {
+	n := 21
+	if len(size) > 0 {
+		n = size[0]
+	}
+
+	return t.RandomStringFrom(n, AlphabetURLSafe)
+}
+
+// IsValidNanoID reports whether s could be a NanoID of size characters, 21 if no size is given
+func (t *Tools) IsValidNanoID(s string, size ...int) bool {
+	n := 21
+	if len(size) > 0 {
+		n = size[0]
+	}
+
+	if len(s) != n {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if !strings.ContainsRune(AlphabetURLSafe, rune(s[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// idClock keeps time ordered IDs made in the same millisecond in order
+var idClock = &monotonicClock{}
+
+type monotonicClock struct {
+	mu sync.Mutex
+
+	v7Millis  int64
+	v7Counter uint16
+
+	ulidMillis  int64
+	ulidEntropy [10]byte
+}
+
+// nextV7 returns the timestamp and 12 bit counter for a UUIDv7. A new millisecond starts the counter
+// at a random value in the lower half of its range, leaving room to count up
+func (c *monotonicClock) nextV7(seed uint16) (int64, uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ms := time.Now().UnixMilli()
+	if ms > c.v7Millis {
+		c.v7Millis = ms
+		c.v7Counter = seed & 0x07ff
+		return c.v7Millis, c.v7Counter
+	}
+
+	c.v7Counter++
+	if c.v7Counter > 0x0fff {
+		// the counter has run out, so borrow the next millisecond
+		c.v7Millis++
+		c.v7Counter = seed & 0x07ff
+	}
+
+	return c.v7Millis, c.v7Counter
+}
+
+// nextULID returns the timestamp and random part for a ULID. Within the same millisecond the previous
+// random part is incremented instead of using a new one
+func (c *monotonicClock) nextULID(entropy [10]byte) (int64, [10]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ms := time.Now().UnixMilli()
+	if ms > c.ulidMillis {
+		c.ulidMillis = ms
+		c.ulidEntropy = entropy
+		return c.ulidMillis, c.ulidEntropy
+	}
+
+	for i := len(c.ulidEntropy) - 1; i >= 0; i-- {
+		c.ulidEntropy[i]++
+		if c.ulidEntropy[i] != 0 {
+			return c.ulidMillis, c.ulidEntropy
+		}
+	}
+
+	// the random part overflowed, so borrow the next millisecond
+	c.ulidMillis++
+	c.ulidEntropy = entropy
+	return c.ulidMillis, c.ulidEntropy
+}
+
+func uint48(b []byte) uint64 {
+	return uint64(b[0])<<40 | uint64(b[1])<<32 | uint64(b[2])<<24 | uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+}
+
+func putUint48(b []byte, v uint64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
@@ -0,0 +1,165 @@
+package toolkit
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+var newIDTests = []struct {
+	name    string
+	scheme  IDScheme
+	pattern string
+}{
+	{name: "random string", scheme: IDRandomString, pattern: `^[A-Za-z0-9_-]{25}$`},
+	{name: "uuid v4", scheme: IDUUIDv4, pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+	{name: "uuid v7", scheme: IDUUIDv7, pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+	{name: "ulid", scheme: IDULID, pattern: `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+	{name: "nanoid", scheme: IDNanoID, pattern: `^[A-Za-z0-9_-]{21}$`},
+}
+
+func TestTools_NewID(t *testing.T) {
+	var tool Tools
+
+	for _, e := range newIDTests {
+		re := regexp.MustCompile(e.pattern)
+		seen := make(map[string]bool)
+
+		for i := 0; i < 100; i++ {
+			id, err := tool.NewID(e.scheme)
+			if err != nil {
+				t.Fatalf("%s: error not expected but one received: %s", e.name, err.Error())
+			}
+
+			if !re.MatchString(id) {
+				t.Errorf("%s: %q doesn't match %s", e.name, id, e.pattern)
+			}
+
+			if seen[id] {
+				t.Errorf("%s: duplicate ID %q", e.name, id)
+			}
+			seen[id] = true
+		}
+	}
+
+	if _, err := tool.NewID("foo"); err == nil {
+		t.Error("expected an error for an unknown scheme")
+	}
+}
+
+func TestTools_TimeOrderedIDsSort(t *testing.T) {
+	var tool Tools
+
+	for _, scheme := range []IDScheme{IDUUIDv7, IDULID} {
+		// made in a tight loop, so most of these share a millisecond
+		ids := make([]string, 1000)
+		for i := range ids {
+			ids[i], _ = tool.NewID(scheme)
+		}
+
+		if !sort.StringsAreSorted(ids) {
+			t.Errorf("%s: IDs are not in the order they were made", scheme)
+		}
+	}
+}
+
+func TestTools_ParseUUID(t *testing.T) {
+	var tool Tools
+
+	before := time.Now().Truncate(time.Millisecond)
+	s, _ := tool.NewUUIDv7()
+
+	u, err := tool.ParseUUID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.String() != s || u.Version() != 7 {
+		t.Errorf("wrong UUID parsed: %s version %d", u, u.Version())
+	}
+
+	// the counter may borrow a millisecond or two from the future
+	if tm, ok := u.Time(); !ok || tm.Before(before) || tm.After(time.Now().Add(time.Second)) {
+		t.Errorf("wrong time in UUID: %s", tm)
+	}
+
+	u, err = tool.ParseUUID("6BA7B810-9DAD-11D1-80B4-00C04FD430C8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.String() != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" || u.Version() != 1 {
+		t.Errorf("wrong UUID parsed: %s version %d", u, u.Version())
+	}
+
+	if _, ok := u.Time(); ok {
+		t.Error("only version 7 UUIDs should have a time")
+	}
+
+	for _, bad := range []string{"", "6ba7b810-9dad-11d1-80b4-00c04fd430c", "6ba7b8109dad11d180b400c04fd430c8", "6ba7b810-9dad-11d1-80b4-00c04fd430cg"} {
+		if _, err := tool.ParseUUID(bad); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("%q: expected ErrInvalidID but got %v", bad, err)
+		}
+	}
+}
+
+func TestTools_ParseULID(t *testing.T) {
+	var tool Tools
+
+	// from the ULID spec
+	u, err := tool.ParseULID("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Time().UnixMilli() != 1469922850259 {
+		t.Errorf("wrong time in ULID: %d", u.Time().UnixMilli())
+	}
+
+	if u.String() != "01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+		t.Errorf("ULID didn't round trip: %s", u)
+	}
+
+	// lower case and the letters Crockford base32 reads as digits are accepted
+	if alt, err := tool.ParseULID("oiarz3ndektsv4rrffq69g5fav"); err != nil || alt != u {
+		t.Errorf("expected the same ULID, got %s %v", alt, err)
+	}
+
+	s, _ := tool.NewULID()
+	if parsed, err := tool.ParseULID(s); err != nil || parsed.String() != s {
+		t.Errorf("new ULID didn't round trip: %s %s %v", s, parsed, err)
+	}
+
+	for _, bad := range []string{"", "01ARZ3NDEKTSV4RRFFQ69G5FA", "81ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FAU"} {
+		if _, err := tool.ParseULID(bad); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("%q: expected ErrInvalidID but got %v", bad, err)
+		}
+	}
+}
+
+func TestTools_NanoID(t *testing.T) {
+	var tool Tools
+
+	id, err := tool.NewNanoID(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tool.IsValidNanoID(id, 10) {
+		t.Errorf("%q should be a valid NanoID", id)
+	}
+
+	if tool.IsValidNanoID(id) {
+		t.Errorf("%q is the wrong length for a default NanoID", id)
+	}
+
+	if tool.IsValidNanoID("abc+def/ghi=jkl.mnopq") {
+		t.Error("NanoIDs can only use URL safe characters")
+	}
+
+	if _, err := tool.NewNanoID(-1); err == nil {
+		t.Error("expected an error for a negative size")
+	}
+}
@@ -0,0 +1,220 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// JSONStreamFunc is called by ReadJSONStream once for every element in the body. Calling decode
+// converts the element into v using the same rules as ReadJSON. Returning an error stops the stream
+type JSONStreamFunc func(index int, decode func(v interface{}) error) error
+
+// JSONStreamError reports which element of a streamed body could not be read. Line is only set
+// for newline-delimited bodies
+type JSONStreamError struct {
+	Index int
+	Line  int
+	Err   error
+}
+
+func (e *JSONStreamError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("element %d (line %d): %s", e.Index, e.Line, e.Err.Error())
+	}
+	return fmt.Sprintf("element %d: %s", e.Index, e.Err.Error())
+}
+
+func (e *JSONStreamError) Unwrap() error {
+	return e.Err
+}
+
+// ReadJSONStream reads a body made up of either newline-delimited JSON values or a single JSON array
+// and hands the elements to fn one at a time, so large imports never have to be held in memory as
+// go values. MaxJsonSize limits each element and MaxJsonStreamSize limits the decompressed body as a whole
+func (t *Tools) ReadJSONStream(w http.ResponseWriter, r *http.Request, fn JSONStreamFunc) error {
+	maxElement := 1024 * 1024
+	if t.MaxJsonSize != 0 {
+		maxElement = t.MaxJsonSize
+	}
+
+	maxTotal := 1024 * 1024 * 100
+	if t.MaxJsonStreamSize != 0 {
+		maxTotal = t.MaxJsonStreamSize
+	}
+
+	if err := decodedRequestBody(w, r, maxTotal); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r.Body)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return jsonDecodeError(err, maxTotal)
+	}
+
+	if first == '[' {
+		return t.readJSONArray(br, fn, maxElement, maxTotal)
+	}
+	return t.readNDJSON(br, fn, maxElement, maxTotal)
+}
+
+// readNDJSON treats every non blank line as a separate JSON value
+func (t *Tools) readNDJSON(br *bufio.Reader, fn JSONStreamFunc, maxElement, maxTotal int) error {
+	index := 0
+	for line := 1; ; line++ {
+		raw, err := readLimitedLine(br, maxElement)
+		if errors.Is(err, errElementTooLarge) {
+			return &JSONStreamError{Index: index, Line: line, Err: fmt.Errorf("element must not be larger than %d bytes", maxElement)}
+		}
+		if err != nil && err != io.EOF {
+			return jsonDecodeError(err, maxTotal)
+		}
+
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 {
+			if fnErr := fn(index, t.jsonElementDecoder(raw, maxElement)); fnErr != nil {
+				return &JSONStreamError{Index: index, Line: line, Err: fnErr}
+			}
+			index++
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// readJSONArray walks the elements of a top level JSON array without decoding the whole array
+func (t *Tools) readJSONArray(br *bufio.Reader, fn JSONStreamFunc, maxElement, maxTotal int) error {
+	lr := &elementLimitReader{r: br, max: int64(maxElement) + elementReadSlack}
+	dec := json.NewDecoder(lr)
+
+	// consume the opening bracket, which has already been peeked
+	if _, err := dec.Token(); err != nil {
+		return jsonDecodeError(err, maxTotal)
+	}
+
+	index := 0
+	for dec.More() {
+		lr.start = dec.InputOffset()
+
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, errElementTooLarge) {
+			return &JSONStreamError{Index: index, Err: fmt.Errorf("element must not be larger than %d bytes", maxElement)}
+		}
+		if err != nil {
+			return &JSONStreamError{Index: index, Err: jsonDecodeError(err, maxTotal)}
+		}
+
+		if len(raw) > maxElement {
+			return &JSONStreamError{Index: index, Err: fmt.Errorf("element must not be larger than %d bytes", maxElement)}
+		}
+
+		if err := fn(index, t.jsonElementDecoder(raw, maxElement)); err != nil {
+			return &JSONStreamError{Index: index, Err: err}
+		}
+		index++
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return jsonDecodeError(err, maxTotal)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("body must contain only one JSON value")
+	}
+
+	return nil
+}
+
+// elementReadSlack is how far past the end of the element limit the decoder may read, which leaves
+// room for the separators around an element and the decoder reading ahead
+const elementReadSlack = 4096
+
+// elementLimitReader stops the array decoder reading more than max bytes past start, the offset the
+// current element begins at, so an oversized element fails while it is read rather than after it
+// has been buffered
+type elementLimitReader struct {
+	r     io.Reader
+	max   int64
+	start int64
+	read  int64
+}
+
+func (l *elementLimitReader) Read(p []byte) (int, error) {
+	allowed := l.start + l.max - l.read
+	if allowed <= 0 {
+		return 0, errElementTooLarge
+	}
+
+	if int64(len(p)) > allowed {
+		p = p[:allowed]
+	}
+
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// jsonElementDecoder returns the decode function handed to a JSONStreamFunc for a single element
+func (t *Tools) jsonElementDecoder(raw []byte, maxBytes int) func(v interface{}) error {
+	return func(v interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		if !t.AllowUnknownFields {
+			dec.DisallowUnknownFields()
+		}
+
+		if err := dec.Decode(v); err != nil {
+			return jsonDecodeError(err, maxBytes)
+		}
+
+		if err := dec.Decode(&struct{}{}); err != io.EOF {
+			return errors.New("element must contain only one JSON value")
+		}
+
+		return nil
+	}
+}
+
+var errElementTooLarge = errors.New("element too large")
+
+// readLimitedLine reads up to and including the next newline, giving up as soon as the line is
+// longer than max so a single huge line can't be buffered
+func readLimitedLine(br *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(bytes.TrimRight(line, "\r\n")) > max {
+			return nil, errElementTooLarge
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return line, err
+	}
+}
+
+// peekNonSpace skips leading whitespace and returns the first significant byte without consuming it
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+
+		return b, br.UnreadByte()
+	}
+}
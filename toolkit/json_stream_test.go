@@ -0,0 +1,139 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var jsonStreamTests = []struct {
+	name          string
+	body          string
+	expected      int
+	errorExpected bool
+	errorIndex    int
+	maxSize       int
+	maxStreamSize int
+}{
+	{name: "ndjson", body: "{\"foo\": \"a\"}\n{\"foo\": \"b\"}\n\n{\"foo\": \"c\"}\n", expected: 3},
+	{name: "ndjson no trailing newline", body: "{\"foo\": \"a\"}\r\n{\"foo\": \"b\"}", expected: 2},
+	{name: "array", body: ` [{"foo": "a"}, {"foo": "b"}]`, expected: 2},
+	{name: "empty array", body: `[]`, expected: 0},
+	{name: "empty body", body: ``, errorExpected: true, errorIndex: -1},
+	{name: "bad ndjson element", body: "{\"foo\": \"a\"}\n{\"foo\": 1}\n", expected: 1, errorExpected: true, errorIndex: 1},
+	{name: "two values on one line", body: "{\"foo\": \"a\"}{\"foo\": \"b\"}\n", errorExpected: true, errorIndex: 0},
+	{name: "bad array element", body: `[{"foo": "a"}, {"fooo": "b"}]`, expected: 1, errorExpected: true, errorIndex: 1},
+	{name: "broken array", body: `[{"foo": "a"}, {"foo": }]`, expected: 1, errorExpected: true, errorIndex: 1},
+	{name: "values after array", body: `[{"foo": "a"}] [{"foo": "b"}]`, expected: 1, errorExpected: true, errorIndex: -1},
+	{name: "ndjson element too large", body: "{\"foo\": \"a\"}\n{\"foo\": \"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb\"}\n", expected: 1, errorExpected: true, errorIndex: 1, maxSize: 20},
+	{name: "array element too large", body: `[{"foo": "a"}, {"foo": "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}]`, expected: 1, errorExpected: true, errorIndex: 1, maxSize: 20},
+	{name: "stream too large", body: strings.Repeat("{\"foo\": \"a\"}\n", 10), expected: 3, errorExpected: true, errorIndex: -1, maxStreamSize: 40},
+}
+
+func TestTools_ReadJSONStream(t *testing.T) {
+	for _, e := range jsonStreamTests {
+		tool := Tools{MaxJsonSize: e.maxSize, MaxJsonStreamSize: e.maxStreamSize}
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader(e.body))
+		rr := httptest.NewRecorder()
+
+		count := 0
+		err := tool.ReadJSONStream(rr, req, func(index int, decode func(v interface{}) error) error {
+			item := struct {
+				Foo string `json:"foo"`
+			}{}
+
+			if err := decode(&item); err != nil {
+				return err
+			}
+
+			count++
+			return nil
+		})
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if count != e.expected {
+			t.Errorf("%s: expected %d elements to be decoded but got %d", e.name, e.expected, count)
+		}
+
+		var streamErr *JSONStreamError
+		if e.errorIndex >= 0 && err != nil {
+			if !errors.As(err, &streamErr) {
+				t.Errorf("%s: expected a JSONStreamError but got %T", e.name, err)
+			} else if streamErr.Index != e.errorIndex {
+				t.Errorf("%s: expected error at element %d but got %d", e.name, e.errorIndex, streamErr.Index)
+			}
+		}
+	}
+}
+
+// countingReader counts how many bytes have been read through it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestTools_ReadJSONStreamLimitsWhileReading(t *testing.T) {
+	tool := Tools{MaxJsonSize: 20}
+
+	for _, body := range []string{
+		`[{"foo": "a"}, {"foo": "` + strings.Repeat("b", 10*1024*1024) + `"}]`,
+		"{\"foo\": \"a\"}\n{\"foo\": \"" + strings.Repeat("b", 10*1024*1024) + "\"}\n",
+	} {
+		counter := &countingReader{r: strings.NewReader(body)}
+		req := httptest.NewRequest("POST", "/", counter)
+
+		err := tool.ReadJSONStream(httptest.NewRecorder(), req, func(index int, decode func(v interface{}) error) error {
+			return nil
+		})
+
+		var streamErr *JSONStreamError
+		if !errors.As(err, &streamErr) || streamErr.Index != 1 {
+			t.Errorf("expected element 1 to be too large, got %v", err)
+		}
+
+		// the oversized element must be rejected long before it has all been read
+		if counter.n > 64*1024 {
+			t.Errorf("read %d bytes before rejecting the element", counter.n)
+		}
+	}
+}
+
+func TestTools_ReadJSONStreamReportsLine(t *testing.T) {
+	tool := Tools{}
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("{\"foo\": \"a\"}\n\n{\"foo\": 1}\n"))
+	rr := httptest.NewRecorder()
+
+	err := tool.ReadJSONStream(rr, req, func(index int, decode func(v interface{}) error) error {
+		var item struct {
+			Foo string `json:"foo"`
+		}
+		return decode(&item)
+	})
+
+	var streamErr *JSONStreamError
+	if !errors.As(err, &streamErr) {
+		t.Fatalf("expected a JSONStreamError but got %v", err)
+	}
+
+	if streamErr.Line != 3 || streamErr.Index != 1 {
+		t.Errorf("expected error at element 1 line 3 but got element %d line %d", streamErr.Index, streamErr.Line)
+	}
+}
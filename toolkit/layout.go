@@ -0,0 +1,153 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrInvalidPath is returned when a file name would escape the upload directory
+var ErrInvalidPath = errors.New("invalid file path")
+
+// UploadLayout decides which subdirectory of the upload directory a file is stored in, so a
+// directory doesn't end up holding every upload
+type UploadLayout interface {
+	// Dir returns the directory, relative to the upload directory, to store fileName in
+	Dir(fileName string, now time.Time) string
+	// Resolve finds fileName under root, returning the full path
+	Resolve(root, fileName string) (string, error)
+}
+
+// HashedLayout stores files in directories named after the SHA-256 of the file name, so with the
+// defaults of 2 levels 2 characters wide "photo.png" is stored as "ab/cd/photo.png". Files spread
+// evenly whatever their names are, and the directory can be worked out from the name alone
+type HashedLayout struct {
+	Levels int
+	Width  int
+}
+
+// Dir returns the hashed directory for fileName
+func (l HashedLayout) Dir(fileName string, now time.Time) string {
+	levels, width := l.Levels, l.Width
+	if levels == 0 {
+		levels = 2
+	}
+	if width == 0 {
+		width = 2
+	}
+
+	sum := sha256.Sum256([]byte(fileName))
+	digest := hex.EncodeToString(sum[:])
+
+	parts := make([]string, 0, levels)
+	for i := 0; i < levels && (i+1)*width <= len(digest); i++ {
+		parts = append(parts, digest[i*width:(i+1)*width])
+	}
+
+	return filepath.Join(parts...)
+}
+
+// Resolve returns where fileName is stored under root
+func (l HashedLayout) Resolve(root, fileName string) (string, error) {
+	if err := checkFileName(fileName); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, l.Dir(fileName, time.Time{}), fileName), nil
+}
+
+// DateLayout stores files in directories named after the upload date, "2006/01/02" unless Format is
+// set, so "photo.png" uploaded on 16 October 2026 is stored as "2026/10/16/photo.png"
+type DateLayout struct {
+	// Format is a time layout using "/" between directories
+	Format string
+	// UTC uses UTC dates rather than local ones
+	UTC bool
+}
+
+func (l DateLayout) format() string {
+	if l.Format == "" {
+		return "2006/01/02"
+	}
+	return l.Format
+}
+
+// Dir returns the dated directory for a file uploaded at now
+func (l DateLayout) Dir(fileName string, now time.Time) string {
+	if l.UTC {
+		now = now.UTC()
+	}
+	return filepath.FromSlash(now.Format(l.format()))
+}
+
+// Resolve finds fileName under root. The date isn't part of the name, so this searches every dated
+// directory and returns the newest match
+func (l DateLayout) Resolve(root, fileName string) (string, error) {
+	if err := checkFileName(fileName); err != nil {
+		return "", err
+	}
+
+	depth := strings.Count(l.format(), "/") + 1
+	pattern := filepath.Join(root, strings.Repeat("*"+string(filepath.Separator), depth)+globEscape(fileName))
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "", fmt.Errorf("%s: %w", fileName, os.ErrNotExist)
+	}
+
+	// dated directories sort in date order, so the last match is the newest
+	return matches[len(matches)-1], nil
+}
+
+// resolveUpload returns the path of file under root. file can be a RelativePath from UploadedFile,
+// or a bare file name which is found using UploadLayout if one is set. Paths can't escape root, and
+// can't reach dotfiles such as the metadata kept by a SidecarStore
+func (t *Tools) resolveUpload(root, file string) (string, error) {
+	clean := path.Clean("/" + filepath.ToSlash(file))
+	if clean == "/" {
+		return "", ErrInvalidPath
+	}
+
+	for _, segment := range strings.Split(clean[1:], "/") {
+		if strings.HasPrefix(segment, ".") {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPath, file)
+		}
+	}
+
+	if !strings.Contains(clean[1:], "/") && t.UploadLayout != nil {
+		return t.UploadLayout.Resolve(root, clean[1:])
+	}
+
+	return filepath.Join(root, filepath.FromSlash(clean)), nil
+}
+
+// checkFileName makes sure name is a single path element and not a dotfile, which would be hidden from
+// the Sweeper and could overwrite a SidecarStore's metadata
+func checkFileName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: %q", ErrInvalidPath, name)
+	}
+	return nil
+}
+
+// globEscape escapes the characters filepath.Glob treats as patterns
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
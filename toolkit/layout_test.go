@@ -0,0 +1,168 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestHashedLayout(t *testing.T) {
+	var layout HashedLayout
+
+	dir := layout.Dir("photo.png", time.Now())
+	if !regexp.MustCompile(`^[0-9a-f]{2}` + regexp.QuoteMeta(string(filepath.Separator)) + `[0-9a-f]{2}$`).MatchString(dir) {
+		t.Errorf("wrong directory: %s", dir)
+	}
+
+	if layout.Dir("photo.png", time.Time{}) != dir {
+		t.Error("directory should only depend on the name")
+	}
+
+	if deep := (HashedLayout{Levels: 3, Width: 1}).Dir("photo.png", time.Now()); !regexp.MustCompile(`^[0-9a-f]/[0-9a-f]/[0-9a-f]$`).MatchString(filepath.ToSlash(deep)) {
+		t.Errorf("wrong directory for 3 levels of 1: %s", deep)
+	}
+
+	resolved, err := layout.Resolve("root", "photo.png")
+	if err != nil || resolved != filepath.Join("root", dir, "photo.png") {
+		t.Errorf("wrong path resolved: %s %v", resolved, err)
+	}
+
+	if _, err := layout.Resolve("root", "../photo.png"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath but got %v", err)
+	}
+}
+
+func TestDateLayout(t *testing.T) {
+	root := t.TempDir()
+	layout := DateLayout{UTC: true}
+
+	day := time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)
+	if dir := layout.Dir("photo.png", day); dir != filepath.Join("2026", "10", "16") {
+		t.Errorf("wrong directory: %s", dir)
+	}
+
+	if dir := (DateLayout{Format: "2006-01"}).Dir("photo.png", day); dir != "2026-10" {
+		t.Errorf("wrong directory for custom format: %s", dir)
+	}
+
+	for _, dir := range []string{"2026/09/01", "2026/10/16"} {
+		_ = os.MkdirAll(filepath.Join(root, dir), 0755)
+		_ = os.WriteFile(filepath.Join(root, dir, "photo[1].png"), []byte("foo"), 0644)
+	}
+
+	resolved, err := layout.Resolve(root, "photo[1].png")
+	if err != nil || resolved != filepath.Join(root, "2026", "10", "16", "photo[1].png") {
+		t.Errorf("wrong path resolved: %s %v", resolved, err)
+	}
+
+	if _, err := layout.Resolve(root, "missing.png"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist but got %v", err)
+	}
+}
+
+func TestTools_UploadFilesWithLayout(t *testing.T) {
+	for _, layout := range []UploadLayout{HashedLayout{}, DateLayout{}} {
+		dir := t.TempDir()
+		tool := Tools{UploadLayout: layout}
+
+		files, err := tool.UploadFiles(newUploadRequest(t, map[string]string{"a.txt": "hello"}), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f := files[0]
+		expected := filepath.ToSlash(filepath.Join(layout.Dir(f.NewFileName, time.Now()), f.NewFileName))
+		if f.RelativePath != expected {
+			t.Errorf("%T: expected relative path %s but got %s", layout, expected, f.RelativePath)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f.RelativePath))); err != nil {
+			t.Errorf("%T: file not stored at its relative path: %s", layout, err)
+		}
+
+		// both the relative path and the bare name can be downloaded
+		for _, name := range []string{f.RelativePath, f.NewFileName} {
+			rr := httptest.NewRecorder()
+			tool.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), dir, name, "a.txt")
+
+			body, _ := io.ReadAll(rr.Result().Body)
+			if rr.Code != http.StatusOK || string(body) != "hello" {
+				t.Errorf("%T: couldn't download %s: %d %q", layout, name, rr.Code, body)
+			}
+		}
+	}
+}
+
+func TestTools_UploadFilesWithoutLayout(t *testing.T) {
+	dir := t.TempDir()
+	var tool Tools
+
+	files, err := tool.UploadFiles(newUploadRequest(t, map[string]string{"a.txt": "hello"}), dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files[0].NewFileName != "a.txt" || files[0].RelativePath != "a.txt" {
+		t.Errorf("wrong names: %+v", files[0])
+	}
+}
+
+func TestTools_DownloadStaticFileTraversal(t *testing.T) {
+	root := t.TempDir()
+	uploads := filepath.Join(root, "uploads")
+	_ = os.MkdirAll(uploads, 0755)
+	_ = os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644)
+	_ = os.WriteFile(filepath.Join(uploads, "public.txt"), []byte("public"), 0644)
+
+	var tool Tools
+
+	for _, name := range []string{"../secret.txt", "../../secret.txt", "/../secret.txt", `..\secret.txt`, "sub/../../secret.txt", ""} {
+		rr := httptest.NewRecorder()
+		tool.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), uploads, name, "x.txt")
+
+		if body, _ := io.ReadAll(rr.Result().Body); string(body) == "secret" {
+			t.Errorf("%q escaped the upload directory", name)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	tool.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), uploads, "public.txt", "x.txt")
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected to download a file in the directory, got %d", rr.Code)
+	}
+}
+
+func TestTools_DownloadStaticFileDotfiles(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "photo.png"), []byte("photo"), 0644)
+
+	store := &SidecarStore{Dir: dir}
+	if err := store.Put(&FileMetadata{NewFileName: "photo.png", OriginalFileName: "private name.png", UploaderID: "user-1"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, ".git", "config"), []byte("secret"), 0644)
+
+	tool := Tools{UploadMetadata: store, UploadLayout: HashedLayout{}}
+
+	for _, name := range []string{".photo.png.meta.json", "/.photo.png.meta.json", "sub/../.photo.png.meta.json", ".git/config"} {
+		rr := httptest.NewRecorder()
+		tool.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), dir, name, "")
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%q: expected 404 but got %d", name, rr.Code)
+		}
+	}
+
+	// and a dotfile can't be uploaded over the metadata either
+	_, err := tool.UploadFiles(newUploadRequest(t, map[string]string{".photo.png.meta.json": "{}"}), dir, false)
+	if !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath uploading a dotfile but got %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMetadataNotFound is returned by a MetadataStore when it has nothing for a file
+var ErrMetadataNotFound = errors.New("file metadata not found")
+
+// FileMetadata describes an uploaded file, recorded by UploadFiles when UploadMetadata is set
+type FileMetadata struct {
+	NewFileName      string    `json:"new_file_name"`
+	OriginalFileName string    `json:"original_file_name"`
+	RelativePath     string    `json:"relative_path"`
+	FileSize         int64     `json:"file_size"`
+	ContentType      string    `json:"content_type"`
+	UploaderID       string    `json:"uploader_id,omitempty"`
+	UploadedAt       time.Time `json:"uploaded_at"`
+	SHA256           string    `json:"sha256"`
+}
+
+// MetadataStore keeps FileMetadata, keyed by NewFileName
+type MetadataStore interface {
+	Put(m *FileMetadata) error
+	Get(newFileName string) (*FileMetadata, error)
+	Delete(newFileName string) error
+	List() ([]*FileMetadata, error)
+}
+
+// MetadataUserUsage returns a function for UploadQuota.UserUsage which adds up the size of every file
+// store has recorded for a user
+func MetadataUserUsage(store MetadataStore) func(userID string) (int64, error) {
+	return func(userID string) (int64, error) {
+		all, err := store.List()
+		if err != nil {
+			return 0, err
+		}
+
+		var total int64
+		for _, m := range all {
+			if m.UploaderID == userID {
+				total += m.FileSize
+			}
+		}
+		return total, nil
+	}
+}
+
+// SidecarStore keeps the metadata for each file in a hidden JSON file, ".<name>.meta.json", in Dir.
+// Dir can be the upload directory itself, since the Sweeper and StaticFiles ignore dotfiles and
+// DownloadStaticFile refuses to serve them
+type SidecarStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+const sidecarSuffix = ".meta.json"
+
+// Put saves m, replacing anything already saved for the same file
+func (s *SidecarStore) Put(m *FileMetadata) error {
+	if err := checkFileName(m.NewFileName); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := (&Tools{}).CreateDirIfNotExists(s.Dir); err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path(m.NewFileName), out)
+}
+
+// Get loads the metadata for newFileName
+func (s *SidecarStore) Get(newFileName string) (*FileMetadata, error) {
+	if err := checkFileName(newFileName); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load(s.path(newFileName))
+}
+
+// Delete removes the metadata for newFileName
+func (s *SidecarStore) Delete(newFileName string) error {
+	if err := checkFileName(newFileName); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(newFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrMetadataNotFound
+	}
+	return err
+}
+
+// List returns the metadata for every file, oldest upload first
+func (s *SidecarStore) List() ([]*FileMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(s.Dir, ".*"+sidecarSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	var all []*FileMetadata
+	for _, file := range files {
+		m, err := s.load(file)
+		if errors.Is(err, ErrMetadataNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, m)
+	}
+
+	sortMetadata(all)
+	return all, nil
+}
+
+func (s *SidecarStore) path(newFileName string) string {
+	return filepath.Join(s.Dir, "."+newFileName+sidecarSuffix)
+}
+
+func (s *SidecarStore) load(file string) (*FileMetadata, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrMetadataNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m FileMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "."), sidecarSuffix)
+		return nil, fmt.Errorf("metadata for %s is corrupt: %w", name, err)
+	}
+
+	return &m, nil
+}
+
+// IndexStore keeps the metadata for every file in a single JSON file at Path. The index is read once
+// and then kept in memory, so only one IndexStore should use a file at a time. If Path is inside the
+// upload directory start its name with a dot, such as ".index.json", so the Sweeper leaves it alone
+type IndexStore struct {
+	Path string
+
+	mu      sync.Mutex
+	entries map[string]*FileMetadata
+}
+
+// Put saves m, replacing anything already saved for the same file
+func (s *IndexStore) Put(m *FileMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	previous, existed := s.entries[m.NewFileName]
+	copied := *m
+	s.entries[m.NewFileName] = &copied
+
+	if err := s.save(); err != nil {
+		if existed {
+			s.entries[m.NewFileName] = previous
+		} else {
+			delete(s.entries, m.NewFileName)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Get returns the metadata for newFileName
+func (s *IndexStore) Get(newFileName string) (*FileMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	m, ok := s.entries[newFileName]
+	if !ok {
+		return nil, ErrMetadataNotFound
+	}
+
+	copied := *m
+	return &copied, nil
+}
+
+// Delete removes the metadata for newFileName
+func (s *IndexStore) Delete(newFileName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	m, ok := s.entries[newFileName]
+	if !ok {
+		return ErrMetadataNotFound
+	}
+
+	delete(s.entries, newFileName)
+	if err := s.save(); err != nil {
+		s.entries[newFileName] = m
+		return err
+	}
+
+	return nil
+}
+
+// List returns the metadata for every file, oldest upload first
+func (s *IndexStore) List() ([]*FileMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	all := make([]*FileMetadata, 0, len(s.entries))
+	for _, m := range s.entries {
+		copied := *m
+		all = append(all, &copied)
+	}
+
+	sortMetadata(all)
+	return all, nil
+}
+
+// open reads the index the first time it is needed. A missing index is empty
+func (s *IndexStore) open() error {
+	if s.entries != nil {
+		return nil
+	}
+
+	entries := make(map[string]*FileMetadata)
+
+	data, err := os.ReadFile(s.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("metadata index %s is corrupt: %w", s.Path, err)
+		}
+	}
+
+	s.entries = entries
+	return nil
+}
+
+func (s *IndexStore) save() error {
+	if err := (&Tools{}).CreateDirIfNotExists(filepath.Dir(s.Path)); err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(s.entries, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, out)
+}
+
+func sortMetadata(all []*FileMetadata) {
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].UploadedAt.Equal(all[j].UploadedAt) {
+			return all[i].NewFileName < all[j].NewFileName
+		}
+		return all[i].UploadedAt.Before(all[j].UploadedAt)
+	})
+}
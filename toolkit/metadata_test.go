@@ -0,0 +1,210 @@
+package toolkit
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadataStores(t *testing.T) {
+	dir := t.TempDir()
+
+	stores := map[string]func() MetadataStore{
+		"sidecar": func() MetadataStore { return &SidecarStore{Dir: filepath.Join(dir, "sidecars")} },
+		"index":   func() MetadataStore { return &IndexStore{Path: filepath.Join(dir, "index", ".index.json")} },
+	}
+
+	for name, open := range stores {
+		store := open()
+		now := time.Now().Truncate(time.Second)
+
+		for i, fileName := range []string{"b.png", "a.png"} {
+			err := store.Put(&FileMetadata{NewFileName: fileName, OriginalFileName: "original " + fileName, FileSize: 10, UploadedAt: now.Add(time.Duration(i) * time.Minute)})
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+
+		// a new store reads back what the first one saved
+		store = open()
+
+		m, err := store.Get("a.png")
+		if err != nil || m.OriginalFileName != "original a.png" || !m.UploadedAt.Equal(now.Add(time.Minute)) {
+			t.Errorf("%s: wrong metadata: %+v %v", name, m, err)
+		}
+
+		// changing the returned value doesn't change the store
+		m.OriginalFileName = "changed"
+		if again, _ := store.Get("a.png"); again.OriginalFileName != "original a.png" {
+			t.Errorf("%s: store was changed through a returned value", name)
+		}
+
+		all, err := store.List()
+		if err != nil || len(all) != 2 || all[0].NewFileName != "b.png" || all[1].NewFileName != "a.png" {
+			t.Errorf("%s: wrong list: %v %v", name, all, err)
+		}
+
+		if err := store.Delete("b.png"); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		if _, err := store.Get("b.png"); !errors.Is(err, ErrMetadataNotFound) {
+			t.Errorf("%s: expected ErrMetadataNotFound after delete but got %v", name, err)
+		}
+
+		if err := store.Delete("b.png"); !errors.Is(err, ErrMetadataNotFound) {
+			t.Errorf("%s: expected ErrMetadataNotFound deleting twice but got %v", name, err)
+		}
+	}
+}
+
+func TestSidecarStore_InvalidNames(t *testing.T) {
+	store := &SidecarStore{Dir: t.TempDir()}
+
+	if err := store.Put(&FileMetadata{NewFileName: "../escape.png"}); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath but got %v", err)
+	}
+
+	if _, err := store.Get("../escape.png"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath but got %v", err)
+	}
+}
+
+func TestTools_UploadFilesMetadata(t *testing.T) {
+	dir := t.TempDir()
+	store := &SidecarStore{Dir: dir}
+
+	tool := Tools{
+		UploadMetadata: store,
+		UploadLayout:   HashedLayout{},
+		UploadUserID: func(r *http.Request) string {
+			return "user-1"
+		},
+	}
+
+	files, err := tool.UploadFiles(newUploadRequest(t, map[string]string{"my photo.txt": "hello"}), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := files[0]
+	if f.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("wrong content type: %s", f.ContentType)
+	}
+
+	m, err := store.Get(f.NewFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.OriginalFileName != "my photo.txt" || m.RelativePath != f.RelativePath || m.FileSize != 5 || m.ContentType != f.ContentType || m.UploaderID != "user-1" || m.UploadedAt.IsZero() {
+		t.Errorf("wrong metadata recorded: %+v", m)
+	}
+
+	// sha256 of "hello"
+	if m.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("wrong hash: %s", m.SHA256)
+	}
+
+	// the original name is used when no display name is given
+	rr := httptest.NewRecorder()
+	tool.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), dir, f.NewFileName, "")
+
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="my photo.txt"` {
+		t.Errorf("wrong content disposition: %s", cd)
+	}
+
+	// the quota can use the recorded sizes
+	usage, err := MetadataUserUsage(store)("user-1")
+	if err != nil || usage != 5 {
+		t.Errorf("expected 5 bytes used but got %d %v", usage, err)
+	}
+
+	tool.UploadQuota = &UploadQuota{MaxUserBytes: 8, UserUsage: MetadataUserUsage(store)}
+	if _, err := tool.UploadFiles(newUploadRequest(t, map[string]string{"b.txt": "world"}), dir); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded but got %v", err)
+	}
+}
+
+func TestTools_DownloadStaticFileWithoutMetadata(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "stored.txt"), []byte("hello"), 0644)
+
+	var tool Tools
+
+	rr := httptest.NewRecorder()
+	tool.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), dir, "stored.txt", "")
+
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="stored.txt"` {
+		t.Errorf("wrong content disposition: %s", cd)
+	}
+}
+
+var contentDispositionTests = []struct {
+	name         string
+	originalName string
+	expected     string
+}{
+	{name: "plain", originalName: "report.pdf", expected: `attachment; filename="report.pdf"`},
+	{name: "injected parameter", originalName: `evil"; filename*=UTF-8''x.html`, expected: `attachment; filename="evil\"; filename*=UTF-8''x.html"`},
+	{name: "backslash", originalName: `a\"b.txt`, expected: `attachment; filename="a\\\"b.txt"`},
+	{name: "header splitting", originalName: "a\r\nSet-Cookie: x=y.txt", expected: `attachment; filename="aSet-Cookie: x=y.txt"`},
+	{name: "unicode", originalName: "résumé 2.pdf", expected: `attachment; filename="r_sum_ 2.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%202.pdf`},
+}
+
+func TestTools_DownloadStaticFileContentDisposition(t *testing.T) {
+	for _, e := range contentDispositionTests {
+		dir := t.TempDir()
+		_ = os.WriteFile(filepath.Join(dir, "stored.txt"), []byte("hello"), 0644)
+
+		store := &SidecarStore{Dir: dir}
+		if err := store.Put(&FileMetadata{NewFileName: "stored.txt", OriginalFileName: e.originalName}); err != nil {
+			t.Fatal(err)
+		}
+
+		tool := Tools{UploadMetadata: store}
+
+		rr := httptest.NewRecorder()
+		tool.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), dir, "stored.txt", "")
+
+		cd := rr.Header().Get("Content-Disposition")
+		if cd != e.expected {
+			t.Errorf("%s: wrong content disposition: %s", e.name, cd)
+		}
+
+		// whatever the name, it has to come back out as the one filename parameter
+		disposition, params, err := mime.ParseMediaType(cd)
+		if err != nil {
+			t.Errorf("%s: unable to parse %s: %s", e.name, cd, err)
+			continue
+		}
+
+		expected := strings.NewReplacer("\r", "", "\n", "").Replace(e.originalName)
+		if disposition != "attachment" || len(params) != 1 || params["filename"] != expected {
+			t.Errorf("%s: parsed as %s %v", e.name, disposition, params)
+		}
+	}
+}
+
+func TestSweeper_DeletesMetadata(t *testing.T) {
+	dir := t.TempDir()
+	store := &SidecarStore{Dir: dir}
+
+	writeAged(t, filepath.Join(dir, "old.txt"), 10, 2*time.Hour)
+	_ = store.Put(&FileMetadata{NewFileName: "old.txt"})
+
+	sweeper := &Sweeper{Dir: dir, TTL: time.Hour, Metadata: store}
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get("old.txt"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("expected the metadata to be removed with the file, got %v", err)
+	}
+}
@@ -0,0 +1,537 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrOutboxItemNotFound is returned when an outbox item does not exist in the store
+var ErrOutboxItemNotFound = errors.New("outbox item not found")
+
+// OutboxState is where an item is in the delivery process
+type OutboxState string
+
+const (
+	// OutboxPending items are waiting to be delivered, or retried
+	OutboxPending OutboxState = "pending"
+	// OutboxDead items ran out of attempts, or failed in a way that can't be retried
+	OutboxDead OutboxState = "dead"
+)
+
+// OutboxItem is a single push waiting in an Outbox. Delivered items are removed from the store
+type OutboxItem struct {
+	ID          string          `json:"id"`
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	Headers     http.Header     `json:"headers,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	State       OutboxState     `json:"state"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	NextAttempt time.Time       `json:"next_attempt"`
+}
+
+// OutboxStore persists outbox items so they survive a restart
+type OutboxStore interface {
+	Save(item *OutboxItem) error
+	Get(id string) (*OutboxItem, error)
+	List(state OutboxState) ([]*OutboxItem, error)
+	Delete(id string) error
+}
+
+// FileOutboxStore is an OutboxStore keeping one JSON file per item in Dir
+type FileOutboxStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// Save writes the item to a temporary file and renames it into place, so a crash part way through
+// never leaves a half written item behind
+func (s *FileOutboxStore) Save(item *OutboxItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := (&Tools{}).CreateDirIfNotExists(s.Dir); err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path(item.ID), out)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place, so readers
+// see either the old contents or the new ones and never a partly written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get loads a single item
+func (s *FileOutboxStore) Get(id string) (*OutboxItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load(s.path(id))
+}
+
+// List returns every item in the given state, oldest first
+func (s *FileOutboxStore) List(state OutboxState) ([]*OutboxItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*OutboxItem
+	for _, file := range files {
+		item, err := s.load(file)
+		if errors.Is(err, ErrOutboxItemNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if item.State == state {
+			items = append(items, item)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+
+	return items, nil
+}
+
+// Delete removes an item
+func (s *FileOutboxStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrOutboxItemNotFound
+	}
+	return err
+}
+
+func (s *FileOutboxStore) path(id string) string {
+	return filepath.Join(s.Dir, filepath.Base(id)+".json")
+}
+
+func (s *FileOutboxStore) load(file string) (*OutboxItem, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, ErrOutboxItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var item OutboxItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("outbox item %s is corrupt: %w", filepath.Base(file), err)
+	}
+
+	return &item, nil
+}
+
+// Outbox delivers pushes in the background from a durable store. Items are enqueued straight into
+// the Store, picked up by a pool of workers and retried with the backoff from RetryPolicy until they
+// succeed or run out of attempts, at which point they are moved to the dead letter list. A delivery
+// refused by an open CircuitBreaker doesn't count as an attempt, and waits for the circuit to let
+// requests through again
+type Outbox struct {
+	// Tools is used to make the remote calls, so its CircuitBreaker, RateLimiter and
+	// WebhookSignatureHeader apply. Its RemoteRetry is ignored, since the outbox does its own retrying
+	Tools *Tools
+	Store OutboxStore
+	// SigningSecret, when set, signs every delivery with SignWebhook. It lives here rather than on
+	// each item so the secret is never written to the store
+	SigningSecret string
+	// Workers is the number of deliveries made at once. Defaults to 4
+	Workers int
+	// RetryPolicy sets the number of attempts and the backoff between them. Defaults to 10 attempts,
+	// starting at 1s and backing off to at most 1h
+	RetryPolicy *RetryPolicy
+	// PollInterval is how often the store is checked for items that are due. Defaults to 1s
+	PollInterval time.Duration
+	// Client defaults to a plain http.Client
+	Client *http.Client
+	// OnDead is called whenever an item is moved to the dead letter list
+	OnDead func(item *OutboxItem)
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+	wake     chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// Enqueue saves req to the store for delivery. req.Data is marshalled straight away, so later changes
+// to it have no effect, and req.Query is added to the stored URL. The item is delivered as soon as a
+// worker is free. Items can't carry their own Client or SigningSecret, set them on the Outbox instead
+func (o *Outbox) Enqueue(req RemoteRequest) (*OutboxItem, error) {
+	if req.Client != nil {
+		return nil, errors.New("outbox items can't have their own client, set Outbox.Client instead")
+	}
+
+	if req.SigningSecret != "" {
+		return nil, errors.New("outbox items can't have their own signing secret, set Outbox.SigningSecret instead")
+	}
+
+	method := "POST"
+	if req.Method != "" {
+		method = req.Method
+	}
+
+	uri, err := req.fullURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var payload json.RawMessage
+	if req.Data != nil {
+		var err error
+		if payload, err = json.Marshal(req.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	// ULIDs sort by time and are safe to use as file names
+	id, err := o.tools().NewULID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	item := &OutboxItem{
+		ID:          id,
+		Method:      method,
+		URL:         uri,
+		Headers:     req.Headers,
+		Payload:     payload,
+		State:       OutboxPending,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+
+	if err := o.Store.Save(item); err != nil {
+		return nil, err
+	}
+
+	o.notify()
+	return item, nil
+}
+
+// Start launches the workers, which run until Stop is called or ctx is done. Items left pending by a
+// previous run are picked up straight away
+func (o *Outbox) Start(ctx context.Context) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cancel != nil {
+		return
+	}
+
+	ctx, o.cancel = context.WithCancel(ctx)
+	o.wake = make(chan struct{}, 1)
+	o.inFlight = make(map[string]bool)
+
+	workers := 4
+	if o.Workers > 0 {
+		workers = o.Workers
+	}
+
+	jobs := make(chan *OutboxItem)
+	for i := 0; i < workers; i++ {
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			for item := range jobs {
+				o.deliver(ctx, item)
+			}
+		}()
+	}
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		defer close(jobs)
+		o.dispatch(ctx, jobs)
+	}()
+}
+
+// Stop stops the workers and waits for any deliveries in progress to finish
+func (o *Outbox) Stop() {
+	o.mu.Lock()
+	cancel := o.cancel
+	o.cancel = nil
+	o.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		o.wg.Wait()
+	}
+}
+
+// List returns the items in the given state, oldest first
+func (o *Outbox) List(state OutboxState) ([]*OutboxItem, error) {
+	return o.Store.List(state)
+}
+
+// Retry moves a dead item back to pending with a fresh set of attempts, and makes it due now
+func (o *Outbox) Retry(id string) error {
+	item, err := o.Store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	item.State = OutboxPending
+	item.Attempts = 0
+	item.NextAttempt = time.Now()
+
+	if err := o.Store.Save(item); err != nil {
+		return err
+	}
+
+	o.notify()
+	return nil
+}
+
+// Purge deletes every item in the given state and returns how many were removed
+func (o *Outbox) Purge(state OutboxState) (int, error) {
+	items, err := o.Store.List(state)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, item := range items {
+		if o.isInFlight(item.ID) {
+			continue
+		}
+
+		if err := o.Store.Delete(item.ID); err != nil && !errors.Is(err, ErrOutboxItemNotFound) {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// dispatch hands due items to the workers whenever the poll interval passes or an item is enqueued
+func (o *Outbox) dispatch(ctx context.Context, jobs chan<- *OutboxItem) {
+	interval := time.Second
+	if o.PollInterval > 0 {
+		interval = o.PollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		items, _ := o.Store.List(OutboxPending)
+
+		now := time.Now()
+		for _, item := range items {
+			if item.NextAttempt.After(now) || !o.claim(item.ID) {
+				continue
+			}
+
+			select {
+			case jobs <- item:
+			case <-ctx.Done():
+				o.release(item.ID)
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// deliver makes a single attempt at an item and records the outcome
+func (o *Outbox) deliver(ctx context.Context, item *OutboxItem) {
+	defer o.release(item.ID)
+
+	policy := o.RetryPolicy
+	if policy == nil {
+		policy = &RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Hour}
+	}
+
+	maxAttempts := 3
+	if policy.MaxAttempts > 0 {
+		maxAttempts = policy.MaxAttempts
+	}
+
+	retryOn := defaultRetryOn
+	if policy.RetryOn != nil {
+		retryOn = policy.RetryOn
+	}
+
+	// the outbox does its own retrying, so each delivery is a single call. The item ID is sent as
+	// the idempotency key so the receiver can spot a delivery that was repeated after a crash
+	tools := *o.tools()
+	tools.RemoteRetry = nil
+
+	headers := item.Headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	if headers.Get(policy.idempotencyHeader()) == "" && !policy.DisableIdempotencyKey {
+		headers.Set(policy.idempotencyHeader(), item.ID)
+	}
+
+	var data interface{}
+	if item.Payload != nil {
+		data = item.Payload
+	}
+
+	response, err := tools.CallRemote(ctx, RemoteRequest{
+		Method:        item.Method,
+		URL:           item.URL,
+		Headers:       headers,
+		Data:          data,
+		Client:        o.Client,
+		SigningSecret: o.SigningSecret,
+	})
+
+	if err != nil && ctx.Err() != nil {
+		// shutting down, so this attempt doesn't count
+		return
+	}
+
+	if errors.Is(err, ErrCircuitOpen) && tools.CircuitBreaker != nil {
+		// the host was never contacted, so this doesn't count as an attempt either. Try again once
+		// the circuit will let a request through
+		if uri, parseErr := url.Parse(item.URL); parseErr == nil {
+			item.LastError = err.Error()
+			item.NextAttempt = tools.CircuitBreaker.retryAt(uri.Host)
+			_ = o.Store.Save(item)
+			return
+		}
+	}
+
+	if err == nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, remoteErrorSnippetSize))
+		response.Body.Close()
+
+		if response.StatusCode >= 200 && response.StatusCode <= 299 {
+			_ = o.Store.Delete(item.ID)
+			return
+		}
+	}
+
+	item.Attempts++
+	if err != nil {
+		item.LastError = err.Error()
+	} else {
+		item.LastError = fmt.Sprintf("remote server returned %s", response.Status)
+	}
+
+	if item.Attempts >= maxAttempts || !retryOn(response, err) {
+		item.State = OutboxDead
+	} else {
+		item.NextAttempt = time.Now().Add(policy.delay(item.Attempts, response))
+	}
+
+	_ = o.Store.Save(item)
+
+	if item.State == OutboxDead && o.OnDead != nil {
+		o.OnDead(item)
+	}
+}
+
+func (o *Outbox) tools() *Tools {
+	if o.Tools == nil {
+		return &Tools{}
+	}
+	return o.Tools
+}
+
+// claim marks an item as being delivered, returning false if a worker already has it
+func (o *Outbox) claim(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.inFlight[id] {
+		return false
+	}
+	o.inFlight[id] = true
+	return true
+}
+
+func (o *Outbox) release(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.inFlight, id)
+}
+
+func (o *Outbox) isInFlight(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.inFlight[id]
+}
+
+// notify wakes the dispatcher so new work is picked up without waiting for the next poll
+func (o *Outbox) notify() {
+	o.mu.Lock()
+	wake := o.wake
+	o.mu.Unlock()
+
+	if wake == nil {
+		return
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
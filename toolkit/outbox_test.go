@@ -0,0 +1,294 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it is true or the timeout passes
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestOutbox_DeliversAfterRestart(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	var keys []string
+	failures := 1
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bodies = append(bodies, string(body))
+	}))
+	defer srv.Close()
+
+	store := &FileOutboxStore{Dir: t.TempDir()}
+
+	// enqueue without any workers running, as if the process died straight after
+	first := &Outbox{Store: store}
+	item, err := first.Enqueue(RemoteRequest{URL: srv.URL, Data: map[string]string{"event": "created"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, _ := first.List(OutboxPending)
+	if len(pending) != 1 || pending[0].ID != item.ID {
+		t.Fatalf("expected the item to be pending, got %v", pending)
+	}
+
+	// a new outbox using the same store picks the item up and retries it until it is delivered
+	second := &Outbox{
+		Store:        &FileOutboxStore{Dir: store.Dir},
+		PollInterval: 10 * time.Millisecond,
+		RetryPolicy:  &RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+	second.Start(context.Background())
+	defer second.Stop()
+
+	delivered := waitFor(t, 2*time.Second, func() bool {
+		items, _ := second.List(OutboxPending)
+		return len(items) == 0
+	})
+	if !delivered {
+		t.Fatal("item was never delivered")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(bodies) != 1 || bodies[0] != `{"event":"created"}` {
+		t.Errorf("wrong payload delivered: %v", bodies)
+	}
+
+	if len(keys) != 2 || keys[0] != item.ID || keys[1] != item.ID {
+		t.Errorf("expected the item ID to be sent as the idempotency key on every attempt, got %v", keys)
+	}
+}
+
+func TestOutbox_DeadLetters(t *testing.T) {
+	status := http.StatusBadRequest
+	var mu sync.Mutex
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	dead := make(chan *OutboxItem, 10)
+	outbox := &Outbox{
+		Store:        &FileOutboxStore{Dir: t.TempDir()},
+		PollInterval: 10 * time.Millisecond,
+		RetryPolicy:  &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		OnDead: func(item *OutboxItem) {
+			dead <- item
+		},
+	}
+	outbox.Start(context.Background())
+	defer outbox.Stop()
+
+	// a 400 can't be fixed by retrying, so it goes straight to the dead letter list
+	item, _ := outbox.Enqueue(RemoteRequest{URL: srv.URL, Data: "foo"})
+
+	select {
+	case d := <-dead:
+		if d.ID != item.ID || d.Attempts != 1 || d.LastError == "" {
+			t.Errorf("wrong dead item reported: %+v", d)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("item never moved to the dead letter list")
+	}
+
+	// a server error uses up every attempt first
+	mu.Lock()
+	status = http.StatusInternalServerError
+	mu.Unlock()
+
+	_, _ = outbox.Enqueue(RemoteRequest{URL: srv.URL, Data: "bar"})
+
+	select {
+	case d := <-dead:
+		if d.Attempts != 2 {
+			t.Errorf("expected 2 attempts but got %d", d.Attempts)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("item never moved to the dead letter list")
+	}
+
+	deadItems, _ := outbox.List(OutboxDead)
+	if len(deadItems) != 2 {
+		t.Fatalf("expected 2 dead items but got %d", len(deadItems))
+	}
+
+	// retrying a dead item once the server has recovered delivers it
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+
+	if err := outbox.Retry(item.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	retried := waitFor(t, 2*time.Second, func() bool {
+		items, _ := outbox.List(OutboxDead)
+		pending, _ := outbox.List(OutboxPending)
+		return len(items) == 1 && len(pending) == 0
+	})
+	if !retried {
+		t.Fatal("retried item was not delivered")
+	}
+
+	purged, err := outbox.Purge(OutboxDead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if purged != 1 {
+		t.Errorf("expected 1 item to be purged but got %d", purged)
+	}
+
+	if items, _ := outbox.List(OutboxDead); len(items) != 0 {
+		t.Errorf("expected no dead items after purge, got %d", len(items))
+	}
+}
+
+func TestOutbox_QueryAndSigning(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var verifyErr error
+
+	receiver := &Tools{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyErr = receiver.VerifyWebhook(w, r, "secret")
+		received <- r
+	}))
+	defer srv.Close()
+
+	store := &FileOutboxStore{Dir: t.TempDir()}
+	outbox := &Outbox{Store: store, SigningSecret: "secret", PollInterval: 10 * time.Millisecond}
+
+	item, err := outbox.Enqueue(RemoteRequest{
+		URL:   srv.URL + "/hook?a=1",
+		Query: url.Values{"b": []string{"2"}},
+		Data:  map[string]string{"event": "created"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the secret is never written to the store
+	files, _ := filepath.Glob(filepath.Join(store.Dir, "*.json"))
+	for _, file := range files {
+		if data, _ := os.ReadFile(file); strings.Contains(string(data), "secret") {
+			t.Errorf("signing secret written to %s", file)
+		}
+	}
+
+	if !strings.Contains(item.URL, "b=2") {
+		t.Errorf("query not stored with the item: %s", item.URL)
+	}
+
+	outbox.Start(context.Background())
+	defer outbox.Stop()
+
+	select {
+	case r := <-received:
+		if r.URL.Path != "/hook" || r.URL.Query().Get("a") != "1" || r.URL.Query().Get("b") != "2" {
+			t.Errorf("wrong url delivered: %s", r.URL)
+		}
+
+		if r.Header.Get("X-Webhook-Signature") == "" || verifyErr != nil {
+			t.Errorf("delivery was not signed correctly: %v", verifyErr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("item was never delivered")
+	}
+}
+
+func TestOutbox_EnqueueRejectsPerItemSettings(t *testing.T) {
+	outbox := &Outbox{Store: &FileOutboxStore{Dir: t.TempDir()}}
+
+	if _, err := outbox.Enqueue(RemoteRequest{URL: "http://example.com", Client: &http.Client{}}); err == nil {
+		t.Error("expected an error for a per item client")
+	}
+
+	if _, err := outbox.Enqueue(RemoteRequest{URL: "http://example.com", SigningSecret: "secret"}); err == nil {
+		t.Error("expected an error for a per item signing secret")
+	}
+
+	if items, _ := outbox.List(OutboxPending); len(items) != 0 {
+		t.Errorf("rejected items were stored: %d", len(items))
+	}
+}
+
+func TestOutbox_CircuitOpenIsNotAnAttempt(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	cb := &CircuitBreaker{FailureThreshold: 1, OpenTimeout: 50 * time.Millisecond}
+	gen, _ := cb.allow(host)
+	cb.record(host, gen, &http.Response{StatusCode: http.StatusBadGateway}, nil)
+
+	outbox := &Outbox{
+		Tools:       &Tools{CircuitBreaker: cb},
+		Store:       &FileOutboxStore{Dir: t.TempDir()},
+		RetryPolicy: &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	}
+
+	item, err := outbox.Enqueue(RemoteRequest{URL: srv.URL, Data: map[string]string{"event": "created"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// refused by the open circuit over and over, without using up any attempts
+	for i := 0; i < 3; i++ {
+		outbox.deliver(context.Background(), item)
+	}
+
+	if item.Attempts != 0 || item.State != OutboxPending || calls != 0 {
+		t.Fatalf("expected no attempts while the circuit is open, got %d attempts, state %s, %d calls", item.Attempts, item.State, calls)
+	}
+
+	if wait := time.Until(item.NextAttempt); wait <= 0 || wait > 50*time.Millisecond {
+		t.Errorf("expected the next attempt when the circuit reopens, got %s from now", wait)
+	}
+
+	time.Sleep(time.Until(item.NextAttempt))
+	outbox.deliver(context.Background(), item)
+
+	if pending, _ := outbox.List(OutboxPending); len(pending) != 0 || calls != 1 {
+		t.Errorf("expected the item to be delivered once the circuit let it through, got %d pending and %d calls", len(pending), calls)
+	}
+}
@@ -0,0 +1,705 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrPatchTestFailed is returned when a JSON Patch test operation does not match the document
+	ErrPatchTestFailed = errors.New("test operation failed")
+	// ErrPatchPathNotFound is returned when a patch refers to a location that does not exist
+	ErrPatchPathNotFound = errors.New("path does not exist")
+	// ErrPatchInvalidPath is returned when a patch contains a malformed JSON pointer
+	ErrPatchInvalidPath = errors.New("invalid JSON pointer")
+)
+
+// JSONPatchError reports which operation of a JSON Patch could not be applied
+type JSONPatchError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *JSONPatchError) Error() string {
+	return fmt.Sprintf("patch operation %d (%s %q): %s", e.Index, e.Op, e.Path, e.Err.Error())
+}
+
+func (e *JSONPatchError) Unwrap() error {
+	return e.Err
+}
+
+// patchOperation is a single entry in an RFC 6902 JSON Patch document. Value is left raw so a
+// missing value can be told apart from an explicit null
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch to a JSON document and returns the patched document.
+// Operations are applied in order and nothing is returned unless every one of them succeeds
+func (t *Tools) ApplyJSONPatch(doc, patch []byte) ([]byte, error) {
+	node, err := decodeJSONDocument(doc)
+	if err != nil {
+		return nil, fmt.Errorf("document is not valid JSON: %w", err)
+	}
+
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("patch must be a JSON array of operations: %w", err)
+	}
+
+	for i, op := range ops {
+		node, err = applyPatchOperation(node, op)
+		if err != nil {
+			path := ""
+			if op.Path != nil {
+				path = *op.Path
+			}
+			return nil, &JSONPatchError{Index: i, Op: op.Op, Path: path, Err: err}
+		}
+	}
+
+	return json.Marshal(node)
+}
+
+// ApplyMergePatch applies an RFC 7396 JSON Merge Patch to a JSON document and returns the patched
+// document. Members set to null in the patch are removed from the document
+func (t *Tools) ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	node, err := decodeJSONDocument(doc)
+	if err != nil {
+		return nil, fmt.Errorf("document is not valid JSON: %w", err)
+	}
+
+	patchNode, err := decodeJSONDocument(patch)
+	if err != nil {
+		return nil, fmt.Errorf("patch is not valid JSON: %w", err)
+	}
+
+	return json.Marshal(mergePatch(node, patchNode))
+}
+
+// ApplyJSONPatchTo applies an RFC 6902 JSON Patch to the go value pointed to by target
+func (t *Tools) ApplyJSONPatchTo(target interface{}, patch []byte) error {
+	return t.patchValue(target, patch, t.ApplyJSONPatch)
+}
+
+// ApplyMergePatchTo applies an RFC 7396 JSON Merge Patch to the go value pointed to by target
+func (t *Tools) ApplyMergePatchTo(target interface{}, patch []byte) error {
+	return t.patchValue(target, patch, t.ApplyMergePatch)
+}
+
+// ReadPatch reads a PATCH request body with the same limits as ReadJSON and applies it to target.
+// Bodies sent as application/json-patch+json are treated as a JSON Patch, anything else as a JSON
+// Merge Patch
+func (t *Tools) ReadPatch(w http.ResponseWriter, r *http.Request, target interface{}) error {
+	var patch json.RawMessage
+	if err := t.ReadJSON(w, r, &patch); err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json-patch+json" {
+		return t.ApplyJSONPatchTo(target, patch)
+	}
+	return t.ApplyMergePatchTo(target, patch)
+}
+
+// patchValue round trips target through JSON so a patch can be applied to it. The result is decoded
+// into a copy of target, so fields JSON can't see, such as unexported and json:"-" fields, keep their
+// values, and target is only changed if the whole patch applies
+func (t *Tools) patchValue(target interface{}, patch []byte, apply func(doc, patch []byte) ([]byte, error)) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("patch target must be a non-nil pointer")
+	}
+
+	doc, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+
+	patched, err := apply(doc, patch)
+	if err != nil {
+		return err
+	}
+
+	before, err := decodeJSONDocument(doc)
+	if err != nil {
+		return err
+	}
+	after, err := decodeJSONDocument(patched)
+	if err != nil {
+		return err
+	}
+
+	updated := reflect.New(rv.Elem().Type())
+	updated.Elem().Set(rv.Elem())
+	preparePatchedValue(updated.Elem(), before, after)
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	if !t.AllowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(updated.Interface()); err != nil {
+		return jsonDecodeError(err, len(patched))
+	}
+
+	rv.Elem().Set(updated.Elem())
+	return nil
+}
+
+// preparePatchedValue gets v, part of a copy of the patch target, ready for the patched JSON to be
+// decoded into it. Members the patch removed or set to null are zeroed, since decoding leaves them
+// alone, and the maps, slices and pointers decoding will write to are copied so the original target
+// is never touched. before and after are the JSON for v before and after the patch
+func preparePatchedValue(v reflect.Value, before, after interface{}) {
+	if after == nil {
+		v.SetZero()
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(v.Elem())
+		v.Set(p)
+		preparePatchedValue(p.Elem(), before, after)
+
+	case reflect.Interface:
+		// decoding replaces whatever an interface holds, unless it's a pointer
+		if v.IsNil() || v.Elem().Kind() != reflect.Pointer || v.Elem().IsNil() {
+			return
+		}
+		p := reflect.New(v.Elem().Type().Elem())
+		p.Elem().Set(v.Elem().Elem())
+		v.Set(p)
+		preparePatchedValue(p.Elem(), before, after)
+
+	case reflect.Struct:
+		beforeObject, ok := before.(map[string]interface{})
+		afterObject, ok2 := after.(map[string]interface{})
+		if !ok || !ok2 {
+			return
+		}
+
+		fields := jsonFields(v.Type())
+		for key, beforeMember := range beforeObject {
+			field, ok := jsonField(v, fields, key)
+			if !ok {
+				continue
+			}
+
+			afterMember, ok := afterObject[key]
+			if !ok {
+				field.SetZero()
+				continue
+			}
+			preparePatchedValue(field, beforeMember, afterMember)
+		}
+
+	case reflect.Map:
+		afterObject, ok := after.(map[string]interface{})
+		if !ok || v.IsNil() {
+			return
+		}
+
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m.SetMapIndex(iter.Key(), iter.Value())
+		}
+
+		if beforeObject, ok := before.(map[string]interface{}); ok {
+			for _, key := range m.MapKeys() {
+				name, ok := jsonMapKey(key)
+				if !ok {
+					continue
+				}
+				if _, ok := beforeObject[name]; !ok {
+					continue
+				}
+				if _, ok := afterObject[name]; !ok {
+					m.SetMapIndex(key, reflect.Value{})
+				}
+			}
+		}
+		v.Set(m)
+
+	case reflect.Slice:
+		beforeArray, ok := before.([]interface{})
+		afterArray, ok2 := after.([]interface{})
+		if !ok || !ok2 || v.IsNil() {
+			return
+		}
+
+		// elements can only be matched up when nothing was added or removed, otherwise they're decoded fresh
+		if len(beforeArray) != len(afterArray) || v.Len() != len(beforeArray) {
+			v.SetZero()
+			return
+		}
+
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(s, v)
+		v.Set(s)
+		for i := range afterArray {
+			preparePatchedValue(s.Index(i), beforeArray[i], afterArray[i])
+		}
+
+	case reflect.Array:
+		beforeArray, ok := before.([]interface{})
+		afterArray, ok2 := after.([]interface{})
+		if !ok || !ok2 || len(beforeArray) != v.Len() || len(afterArray) != v.Len() {
+			return
+		}
+
+		for i := range afterArray {
+			preparePatchedValue(v.Index(i), beforeArray[i], afterArray[i])
+		}
+	}
+}
+
+// jsonMapKey returns the member name encoding/json uses for a map key
+func jsonMapKey(k reflect.Value) (string, bool) {
+	if k.Kind() == reflect.String {
+		return k.String(), true
+	}
+
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", true
+		}
+		b, err := tm.MarshalText()
+		return string(b), err == nil
+	}
+
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), true
+	}
+	return "", false
+}
+
+// jsonFields maps the names encoding/json uses for the fields of a struct type to their indexes,
+// including the fields promoted from embedded structs
+func jsonFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+	var embedded []reflect.StructField
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, f)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Index
+	}
+
+	// fields declared directly win over promoted ones
+	for _, f := range embedded {
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		for name, index := range jsonFields(ft) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = append(append([]int{}, f.Index...), index...)
+			}
+		}
+	}
+
+	return fields
+}
+
+// jsonField returns the settable field of the struct v for a JSON member name, matching names
+// without regard to case the way decoding does
+func jsonField(v reflect.Value, fields map[string][]int, key string) (reflect.Value, bool) {
+	index, ok := fields[key]
+	if !ok {
+		for name, i := range fields {
+			if strings.EqualFold(name, key) {
+				index, ok = i, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	field, err := v.FieldByIndexErr(index)
+	if err != nil || !field.CanSet() {
+		return reflect.Value{}, false
+	}
+	return field, true
+}
+
+// decodeJSONDocument decodes a single JSON value, keeping numbers exact
+func decodeJSONDocument(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var node interface{}
+	if err := dec.Decode(&node); err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("must contain only one JSON value")
+	}
+
+	return node, nil
+}
+
+func applyPatchOperation(node interface{}, op patchOperation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, errors.New("operation is missing a path")
+	}
+
+	path, err := parseJSONPointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("operation is missing a value")
+		}
+		if value, err = decodeJSONDocument(op.Value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.New("operation is missing from")
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+
+	switch op.Op {
+	case "add":
+		return patchAdd(node, path, value)
+	case "remove":
+		return patchRemove(node, path)
+	case "replace":
+		if _, err := patchGet(node, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if node, err = patchRemove(node, path); err != nil {
+			return nil, err
+		}
+		return patchAdd(node, path, value)
+	case "test":
+		current, err := patchGet(node, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, value) {
+			return nil, ErrPatchTestFailed
+		}
+		return node, nil
+	}
+
+	from, err := parseJSONPointer(*op.From)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := patchGet(node, from)
+	if err != nil {
+		return nil, err
+	}
+
+	if op.Op == "copy" {
+		return patchAdd(node, path, deepCopyJSON(current))
+	}
+
+	if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+		return nil, errors.New("cannot move a value into one of its own children")
+	}
+
+	if node, err = patchRemove(node, from); err != nil {
+		return nil, err
+	}
+	return patchAdd(node, path, current)
+}
+
+// parseJSONPointer splits an RFC 6901 JSON pointer into its unescaped reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrPatchInvalidPath
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, ErrPatchInvalidPath
+			}
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex converts a reference token into an index no greater than max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrPatchInvalidPath
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, ErrPatchInvalidPath
+	}
+
+	if i > max {
+		return 0, ErrPatchPathNotFound
+	}
+
+	return i, nil
+}
+
+func patchGet(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, ErrPatchPathNotFound
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, ErrPatchPathNotFound
+		}
+	}
+
+	return node, nil
+}
+
+// patchAt walks down to the container holding the last token of path and calls fn with it. The
+// containers are rebuilt on the way back up since inserting into or removing from an array can
+// reallocate it
+func patchAt(node interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, ErrPatchPathNotFound
+		}
+		child, err := patchAt(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = child
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := patchAt(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	default:
+		return nil, ErrPatchPathNotFound
+	}
+}
+
+func patchAdd(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return patchAt(node, path, func(parent interface{}, token string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			n[token] = value
+			return n, nil
+		case []interface{}:
+			if token == "-" {
+				return append(n, value), nil
+			}
+			i, err := arrayIndex(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		default:
+			return nil, ErrPatchPathNotFound
+		}
+	})
+}
+
+func patchRemove(node interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+
+	return patchAt(node, path, func(parent interface{}, token string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := n[token]; !ok {
+				return nil, ErrPatchPathNotFound
+			}
+			delete(n, token)
+			return n, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(n[:i], n[i+1:]...), nil
+		default:
+			return nil, ErrPatchPathNotFound
+		}
+	})
+}
+
+// mergePatch implements the MergePatch function from RFC 7396
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	doc, ok := target.(map[string]interface{})
+	if !ok {
+		doc = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(doc, k)
+		} else {
+			doc[k] = mergePatch(doc[k], v)
+		}
+	}
+
+	return doc
+}
+
+// jsonEqual compares two decoded JSON values, treating numbers as equal when their values match
+// even if they were written differently, e.g. 1 and 1.0
+func jsonEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, okx := new(big.Float).SetString(x.String())
+		fy, oky := new(big.Float).SetString(y.String())
+		return okx && oky && fx.Cmp(fy) == 0
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func deepCopyJSON(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			out[k] = deepCopyJSON(v)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(n))
+		for i, v := range n {
+			out[i] = deepCopyJSON(v)
+		}
+		return out
+	default:
+		return node
+	}
+}
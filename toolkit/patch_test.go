@@ -0,0 +1,257 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+var jsonPatchTests = []struct {
+	name          string
+	doc           string
+	patch         string
+	expected      string
+	expectedError error
+	errorExpected bool
+}{
+	{name: "add member", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`, expected: `{"baz":"qux","foo":"bar"}`},
+	{name: "add array element", doc: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`, expected: `{"foo":["bar","qux","baz"]}`},
+	{name: "append array element", doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, expected: `{"foo":["bar",["abc","def"]]}`},
+	{name: "remove member", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, expected: `{"foo":"bar"}`},
+	{name: "remove array element", doc: `{"foo":["bar","qux","baz"]}`, patch: `[{"op":"remove","path":"/foo/1"}]`, expected: `{"foo":["bar","baz"]}`},
+	{name: "replace", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"boo"}]`, expected: `{"baz":"boo","foo":"bar"}`},
+	{name: "replace root", doc: `{"foo":"bar"}`, patch: `[{"op":"replace","path":"","value":[1]}]`, expected: `[1]`},
+	{name: "move", doc: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+	{name: "move array element", doc: `{"foo":["all","grass","cows","eat"]}`, patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, expected: `{"foo":["all","cows","eat","grass"]}`},
+	{name: "copy", doc: `{"foo":{"a":1}}`, patch: `[{"op":"copy","from":"/foo","path":"/bar"},{"op":"replace","path":"/bar/a","value":2}]`, expected: `{"bar":{"a":2},"foo":{"a":1}}`},
+	{name: "test passes", doc: `{"baz":"qux","foo":["a",2,"c"]}`, patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, expected: `{"baz":"qux","foo":["a",2,"c"]}`},
+	{name: "escaped pointer", doc: `{"a/b":1,"m~n":2}`, patch: `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/m~0n","value":3}]`, expected: `{"m~n":3}`},
+	{name: "null value", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/foo","value":null}]`, expected: `{"foo":null}`},
+	{name: "test fails", doc: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`, expectedError: ErrPatchTestFailed, errorExpected: true},
+	{name: "missing path", doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, expectedError: ErrPatchPathNotFound, errorExpected: true},
+	{name: "missing parent", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, expectedError: ErrPatchPathNotFound, errorExpected: true},
+	{name: "index out of range", doc: `{"foo":[1]}`, patch: `[{"op":"add","path":"/foo/5","value":2}]`, expectedError: ErrPatchPathNotFound, errorExpected: true},
+	{name: "leading zero index", doc: `{"foo":[1,2]}`, patch: `[{"op":"remove","path":"/foo/01"}]`, expectedError: ErrPatchInvalidPath, errorExpected: true},
+	{name: "bad pointer", doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"foo"}]`, expectedError: ErrPatchInvalidPath, errorExpected: true},
+	{name: "bad escape", doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"/f~2"}]`, expectedError: ErrPatchInvalidPath, errorExpected: true},
+	{name: "missing value", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz"}]`, errorExpected: true},
+	{name: "unknown op", doc: `{"foo":"bar"}`, patch: `[{"op":"frob","path":"/foo"}]`, errorExpected: true},
+	{name: "move into child", doc: `{"foo":{"bar":1}}`, patch: `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, errorExpected: true},
+	{name: "patch not an array", doc: `{"foo":"bar"}`, patch: `{"op":"remove","path":"/foo"}`, errorExpected: true},
+}
+
+func TestTools_ApplyJSONPatch(t *testing.T) {
+	tool := &Tools{}
+
+	for _, e := range jsonPatchTests {
+		out, err := tool.ApplyJSONPatch([]byte(e.doc), []byte(e.patch))
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected error %q but got %v", e.name, e.expectedError, err)
+		}
+
+		if !e.errorExpected && string(out) != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, out)
+		}
+	}
+}
+
+func TestTools_ApplyJSONPatchReportsOperation(t *testing.T) {
+	tool := &Tools{}
+
+	_, err := tool.ApplyJSONPatch([]byte(`{"foo":"bar"}`), []byte(`[{"op":"test","path":"/foo","value":"bar"},{"op":"test","path":"/foo","value":"baz"}]`))
+
+	var patchErr *JSONPatchError
+	if !errors.As(err, &patchErr) {
+		t.Fatalf("expected a JSONPatchError but got %v", err)
+	}
+
+	if patchErr.Index != 1 || patchErr.Op != "test" || patchErr.Path != "/foo" {
+		t.Errorf("wrong operation reported: %+v", patchErr)
+	}
+}
+
+var mergePatchTests = []struct {
+	name     string
+	doc      string
+	patch    string
+	expected string
+}{
+	{name: "replace member", doc: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+	{name: "add member", doc: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+	{name: "remove member", doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+	{name: "replace array", doc: `{"a":["b"]}`, patch: `{"a":["c","d"]}`, expected: `{"a":["c","d"]}`},
+	{name: "nested", doc: `{"a":{"b":"c","d":"e"}}`, patch: `{"a":{"d":null,"f":"g"}}`, expected: `{"a":{"b":"c","f":"g"}}`},
+	{name: "non object patch", doc: `{"a":"b"}`, patch: `["c"]`, expected: `["c"]`},
+	{name: "object into non object", doc: `["a"]`, patch: `{"a":{"b":null}}`, expected: `{"a":{}}`},
+}
+
+func TestTools_ApplyMergePatch(t *testing.T) {
+	tool := &Tools{}
+
+	for _, e := range mergePatchTests {
+		out, err := tool.ApplyMergePatch([]byte(e.doc), []byte(e.patch))
+		if err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if string(out) != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, out)
+		}
+	}
+}
+
+type patchTarget struct {
+	Name  string   `json:"name"`
+	Email string   `json:"email,omitempty"`
+	Tags  []string `json:"tags"`
+}
+
+func TestTools_ReadPatch(t *testing.T) {
+	var patchRequests = []struct {
+		name          string
+		contentType   string
+		body          string
+		expected      patchTarget
+		errorExpected bool
+	}{
+		{name: "merge patch", contentType: "application/merge-patch+json", body: `{"email":null,"tags":["b"]}`, expected: patchTarget{Name: "jack", Tags: []string{"b"}}},
+		{name: "plain json is a merge patch", contentType: "application/json", body: `{"name":"jill"}`, expected: patchTarget{Name: "jill", Email: "jack@example.com", Tags: []string{"a"}}},
+		{name: "json patch", contentType: "application/json-patch+json", body: `[{"op":"add","path":"/tags/-","value":"b"}]`, expected: patchTarget{Name: "jack", Email: "jack@example.com", Tags: []string{"a", "b"}}},
+		{name: "failed test", contentType: "application/json-patch+json", body: `[{"op":"test","path":"/name","value":"jill"}]`, errorExpected: true},
+		{name: "unknown field", contentType: "application/merge-patch+json", body: `{"nickname":"jj"}`, errorExpected: true},
+	}
+
+	tool := &Tools{}
+
+	for _, e := range patchRequests {
+		target := patchTarget{Name: "jack", Email: "jack@example.com", Tags: []string{"a"}}
+
+		req := httptest.NewRequest("PATCH", "/", bytes.NewBufferString(e.body))
+		req.Header.Set("Content-Type", e.contentType)
+		rr := httptest.NewRecorder()
+
+		err := tool.ReadPatch(rr, req, &target)
+
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected, but none received", e.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+			continue
+		}
+
+		if target.Name != e.expected.Name || target.Email != e.expected.Email || len(target.Tags) != len(e.expected.Tags) {
+			t.Errorf("%s: expected %+v but got %+v", e.name, e.expected, target)
+		}
+	}
+}
+
+type patchProfile struct {
+	Bio   string `json:"bio"`
+	token string
+}
+
+type patchAccount struct {
+	Name     string            `json:"name"`
+	Hash     string            `json:"-"`
+	Labels   map[string]string `json:"labels"`
+	Profile  *patchProfile     `json:"profile"`
+	Sessions []patchProfile    `json:"sessions"`
+	secret   int
+}
+
+func newPatchAccount() patchAccount {
+	return patchAccount{
+		Name:     "jack",
+		Hash:     "hash",
+		Labels:   map[string]string{"a": "1", "b": "2"},
+		Profile:  &patchProfile{Bio: "hi", token: "profile-token"},
+		Sessions: []patchProfile{{Bio: "one", token: "session-token"}},
+		secret:   42,
+	}
+}
+
+func TestTools_ApplyPatchToKeepsHiddenFields(t *testing.T) {
+	var patchHiddenTests = []struct {
+		name     string
+		json     bool
+		patch    string
+		expected func(a patchAccount) bool
+	}{
+		{name: "merge patch", patch: `{"name":"jill"}`, expected: func(a patchAccount) bool {
+			return a.Name == "jill" && len(a.Labels) == 2
+		}},
+		{name: "merge patch removes map key", patch: `{"labels":{"a":null}}`, expected: func(a patchAccount) bool {
+			return len(a.Labels) == 1 && a.Labels["b"] == "2"
+		}},
+		{name: "merge patch removes nested member", patch: `{"profile":{"bio":null}}`, expected: func(a patchAccount) bool {
+			return a.Profile.Bio == ""
+		}},
+		{name: "json patch replaces with null", json: true, patch: `[{"op":"replace","path":"/name","value":null}]`, expected: func(a patchAccount) bool {
+			return a.Name == ""
+		}},
+		{name: "json patch changes a slice element", json: true, patch: `[{"op":"replace","path":"/sessions/0/bio","value":"two"}]`, expected: func(a patchAccount) bool {
+			return a.Sessions[0].Bio == "two"
+		}},
+	}
+
+	tool := &Tools{}
+
+	for _, e := range patchHiddenTests {
+		target := newPatchAccount()
+		original := target.Profile
+
+		var err error
+		if e.json {
+			err = tool.ApplyJSONPatchTo(&target, []byte(e.patch))
+		} else {
+			err = tool.ApplyMergePatchTo(&target, []byte(e.patch))
+		}
+
+		if err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+			continue
+		}
+
+		if !e.expected(target) {
+			t.Errorf("%s: wrong result %+v", e.name, target)
+		}
+
+		if target.Hash != "hash" || target.secret != 42 || target.Profile.token != "profile-token" || target.Sessions[0].token != "session-token" {
+			t.Errorf("%s: hidden fields lost: %+v %+v %+v", e.name, target, target.Profile, target.Sessions)
+		}
+
+		if original.Bio != "hi" {
+			t.Errorf("%s: the original profile was changed", e.name)
+		}
+	}
+}
+
+func TestTools_ApplyPatchToFailureLeavesTarget(t *testing.T) {
+	tool := &Tools{}
+	target := newPatchAccount()
+	labels := target.Labels
+
+	err := tool.ApplyMergePatchTo(&target, []byte(`{"name":"jill","labels":{"a":null,"c":"3"},"nickname":"jj"}`))
+	if err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+
+	if target.Name != "jack" || len(labels) != 2 || labels["a"] != "1" || target.Hash != "hash" {
+		t.Errorf("target changed by a failed patch: %+v", target)
+	}
+}
@@ -0,0 +1,227 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RemoteRequest describes a call made to a remote server with CallRemote
+type RemoteRequest struct {
+	// Method defaults to POST
+	Method string
+	URL    string
+	// Query is added to any query string already in URL
+	Query url.Values
+	// Headers are sent with every attempt and override the defaults, such as Content-Type
+	Headers http.Header
+	// Data is sent as the JSON body of the request. A nil Data sends no body at all
+	Data interface{}
+	// Client defaults to a plain http.Client
+	Client *http.Client
+	// SigningSecret, when set, signs every attempt with SignWebhook so the receiver can check it with
+	// VerifyWebhook
+	SigningSecret string
+}
+
+// fullURL returns URL with Query added to it
+func (req RemoteRequest) fullURL() (string, error) {
+	uri, err := url.Parse(req.URL)
+	if err != nil {
+		return "", err
+	}
+
+	if len(req.Query) > 0 {
+		q := uri.Query()
+		for key, values := range req.Query {
+			for _, value := range values {
+				q.Add(key, value)
+			}
+		}
+		uri.RawQuery = q.Encode()
+	}
+
+	return uri.String(), nil
+}
+
+// CallRemote sends req to a remote server, using ctx for deadlines and cancellation. Data is sent as
+// JSON, gzipped when CompressRemoteJSON is set, and the call is retried according to RemoteRetry.
+// Every attempt goes through the CircuitBreaker and RateLimiter for the host, if they are set.
+// The caller is responsible for closing the body of the returned response
+func (t *Tools) CallRemote(ctx context.Context, req RemoteRequest) (*http.Response, error) {
+	method := "POST"
+	if req.Method != "" {
+		method = req.Method
+	}
+
+	uri, err := req.fullURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var payload []byte
+	if req.Data != nil {
+		payload, err = json.Marshal(req.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.CompressRemoteJSON {
+			payload, err = gzipPayload(payload)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	httpClient := &http.Client{}
+	if req.Client != nil {
+		httpClient = req.Client
+	}
+
+	idempotencyHeader := t.RemoteRetry.idempotencyHeader()
+	idempotencyKey := req.Headers.Get(idempotencyHeader)
+	if idempotencyKey == "" {
+		idempotencyKey, err = t.RemoteRetry.idempotencyKey(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t.RemoteRetry.do(ctx, t.sendRemote(ctx, httpClient), func() (*http.Request, error) {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+
+		request, err := http.NewRequestWithContext(ctx, method, uri, body)
+		if err != nil {
+			return nil, err
+		}
+
+		if payload != nil {
+			request.Header.Set("Content-Type", "application/json")
+			if t.CompressRemoteJSON {
+				request.Header.Set("Content-Encoding", "gzip")
+			}
+		}
+
+		if idempotencyKey != "" {
+			request.Header.Set(idempotencyHeader, idempotencyKey)
+		}
+
+		for key, values := range req.Headers {
+			request.Header[http.CanonicalHeaderKey(key)] = values
+		}
+
+		if req.SigningSecret != "" {
+			request.Header.Set(t.webhookSignatureHeader(), t.SignWebhook(payload, req.SigningSecret, time.Now()))
+		}
+
+		return request, nil
+	})
+}
+
+// sendRemote returns the function used to send each attempt, which checks the circuit breaker and
+// waits on the rate limiter before handing the request to client
+func (t *Tools) sendRemote(ctx context.Context, client *http.Client) func(*http.Request) (*http.Response, error) {
+	return func(request *http.Request) (*http.Response, error) {
+		host := request.URL.Host
+
+		if t.RateLimiter != nil {
+			if err := t.RateLimiter.Wait(ctx, host); err != nil {
+				return nil, err
+			}
+		}
+
+		if t.CircuitBreaker == nil {
+			return client.Do(request)
+		}
+
+		generation, err := t.CircuitBreaker.allow(host)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := client.Do(request)
+		t.CircuitBreaker.record(host, generation, response, err)
+
+		return response, err
+	}
+}
+
+// RemoteError is returned when a remote server responds with a status outside of the 2xx range.
+// Body holds the start of the response so the reason for the failure can be logged
+type RemoteError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *RemoteError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("remote server returned %s", e.Status)
+	}
+	return fmt.Sprintf("remote server returned %s: %s", e.Status, e.Body)
+}
+
+// remoteErrorSnippetSize is how much of a failed response is kept in a RemoteError
+const remoteErrorSnippetSize = 512
+
+// CallRemoteJSON sends req with CallRemote and decodes the JSON response into out, returning the status
+// code. The response may be no larger than MaxRemoteResponseSize, and a non 2xx status is returned as
+// a *RemoteError. An empty response, or a nil out, leaves out untouched
+func (t *Tools) CallRemoteJSON(ctx context.Context, req RemoteRequest, out interface{}) (int, error) {
+	maxBytes := 1024 * 1024 * 10
+	if t.MaxRemoteResponseSize != 0 {
+		maxBytes = t.MaxRemoteResponseSize
+	}
+
+	response, err := t.CallRemote(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(response.Body, remoteErrorSnippetSize))
+		return response.StatusCode, &RemoteError{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Header:     response.Header,
+			Body:       bytes.TrimSpace(snippet),
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, int64(maxBytes)+1))
+	if err != nil {
+		return response.StatusCode, err
+	}
+
+	if len(body) > maxBytes {
+		return response.StatusCode, fmt.Errorf("response must not be larger than %d bytes", maxBytes)
+	}
+
+	if out == nil || len(bytes.TrimSpace(body)) == 0 {
+		return response.StatusCode, nil
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return response.StatusCode, fmt.Errorf("error decoding remote response: %w", err)
+	}
+
+	return response.StatusCode, nil
+}
+
+// CallRemoteAs is a generic version of CallRemoteJSON which returns the decoded response as a T
+func CallRemoteAs[T any](ctx context.Context, t *Tools, req RemoteRequest) (T, error) {
+	var out T
+	_, err := t.CallRemoteJSON(ctx, req, &out)
+	return out, err
+}
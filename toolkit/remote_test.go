@@ -0,0 +1,213 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AMagicRake/toolkit/tooltest"
+)
+
+func TestTools_CallRemote(t *testing.T) {
+	var received *http.Request
+	var body string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	tool := &Tools{}
+
+	headers := make(http.Header)
+	headers.Set("Authorization", "Bearer token")
+	headers.Set("X-Trace-Id", "abc")
+
+	response, err := tool.CallRemote(context.Background(), RemoteRequest{
+		Method:  "PUT",
+		URL:     srv.URL + "/some/path?a=1",
+		Query:   url.Values{"b": []string{"2"}},
+		Headers: headers,
+		Data:    map[string]string{"foo": "bar"},
+	})
+	if err != nil {
+		t.Fatal("failed to call remote url: ", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		t.Errorf("wrong status code returned: %d", response.StatusCode)
+	}
+
+	reply, _ := io.ReadAll(response.Body)
+	if string(reply) != `{"ok":true}` {
+		t.Errorf("expected to be able to read the response body, got %q", reply)
+	}
+
+	if received.Method != "PUT" {
+		t.Errorf("wrong method sent: %s", received.Method)
+	}
+
+	if received.URL.Path != "/some/path" || received.URL.Query().Get("a") != "1" || received.URL.Query().Get("b") != "2" {
+		t.Errorf("wrong url sent: %s", received.URL)
+	}
+
+	if received.Header.Get("Authorization") != "Bearer token" || received.Header.Get("X-Trace-Id") != "abc" {
+		t.Errorf("custom headers not sent: %v", received.Header)
+	}
+
+	if received.Header.Get("Content-Type") != "application/json" || body != `{"foo":"bar"}` {
+		t.Errorf("wrong body sent: %s %s", received.Header.Get("Content-Type"), body)
+	}
+}
+
+func TestTools_CallRemoteWithoutData(t *testing.T) {
+	var contentLength int64 = -1
+	var contentType string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		contentType = r.Header.Get("Content-Type")
+	}))
+	defer srv.Close()
+
+	tool := &Tools{}
+
+	response, err := tool.CallRemote(context.Background(), RemoteRequest{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if contentLength != 0 || contentType != "" {
+		t.Errorf("expected no body to be sent, got %d bytes of %q", contentLength, contentType)
+	}
+}
+
+func TestTools_CallRemoteContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	tool := &Tools{RemoteRetry: &RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := tool.CallRemote(ctx, RemoteRequest{URL: srv.URL, Data: "foo"})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Error("retries carried on after the context was done")
+	}
+}
+
+var remoteJSONTests = []struct {
+	name           string
+	status         int
+	body           string
+	maxSize        int
+	expectedFoo    string
+	expectedStatus int
+	errorExpected  bool
+	remoteError    bool
+}{
+	{name: "ok", status: http.StatusOK, body: `{"foo":"bar"}`, expectedFoo: "bar", expectedStatus: http.StatusOK},
+	{name: "no content", status: http.StatusNoContent, expectedStatus: http.StatusNoContent},
+	{name: "server error", status: http.StatusBadGateway, body: `{"error":"upstream down"}`, expectedStatus: http.StatusBadGateway, errorExpected: true, remoteError: true},
+	{name: "not found", status: http.StatusNotFound, expectedStatus: http.StatusNotFound, errorExpected: true, remoteError: true},
+	{name: "bad json", status: http.StatusOK, body: `{"foo":`, expectedStatus: http.StatusOK, errorExpected: true},
+	{name: "too large", status: http.StatusOK, body: `{"foo":"barbarbarbar"}`, maxSize: 10, expectedStatus: http.StatusOK, errorExpected: true},
+}
+
+func TestTools_CallRemoteJSON(t *testing.T) {
+	for _, e := range remoteJSONTests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(e.status)
+			_, _ = w.Write([]byte(e.body))
+		}))
+
+		tool := &Tools{MaxRemoteResponseSize: e.maxSize}
+
+		var out struct {
+			Foo string `json:"foo"`
+		}
+
+		status, err := tool.CallRemoteJSON(context.Background(), RemoteRequest{URL: srv.URL, Data: "foo"}, &out)
+		srv.Close()
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		var remoteErr *RemoteError
+		if errors.As(err, &remoteErr) != e.remoteError {
+			t.Errorf("%s: expected remote error %v but got %v", e.name, e.remoteError, err)
+		} else if e.remoteError && (remoteErr.StatusCode != e.status || string(remoteErr.Body) != e.body) {
+			t.Errorf("%s: wrong remote error %+v", e.name, remoteErr)
+		}
+
+		if status != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, status)
+		}
+
+		if out.Foo != e.expectedFoo {
+			t.Errorf("%s: expected foo %q but got %q", e.name, e.expectedFoo, out.Foo)
+		}
+	}
+}
+
+func TestCallRemoteAs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[1,2,3]`))
+	}))
+	defer srv.Close()
+
+	out, err := CallRemoteAs[[]int](context.Background(), &Tools{}, RemoteRequest{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 3 || out[2] != 3 {
+		t.Errorf("wrong value decoded: %v", out)
+	}
+}
+
+func TestTools_PushJSONToRemoteWithFakeTransport(t *testing.T) {
+	tr := tooltest.NewTransport()
+	tr.Expect("POST", "/some/path").
+		WithHeader("Content-Type", "application/json").
+		WithJSONBody(map[string]string{"bar": "bar"}).
+		Respond(http.StatusOK, "ok")
+
+	tool := &Tools{}
+
+	_, status, err := tool.PushJSONToRemote("http://example.com/some/path", map[string]string{"bar": "bar"}, tr.Client())
+	if err != nil {
+		t.Error("failed to call remote url: ", err)
+	}
+
+	if status != http.StatusOK {
+		t.Errorf("wrong status code returned: %d", status)
+	}
+
+	tr.AssertExpectations(t)
+}
@@ -0,0 +1,317 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned by UploadFiles when storing a file would go over the UploadQuota
+var ErrQuotaExceeded = errors.New("upload quota exceeded")
+
+// UploadQuota limits how much UploadFiles will store. Sizes come from the multipart headers, so files
+// are refused before anything is written. Uploads running at the same time in one process share their
+// reservations, so they can't race past a limit together, but separate processes sharing a directory
+// can still go over it between them
+type UploadQuota struct {
+	// MaxTotalBytes is the most the upload directory can hold, counting files already in it
+	MaxTotalBytes int64
+	// TotalUsage returns how many bytes are already stored in the upload directory. It defaults to
+	// walking the whole directory on every upload, which gets slow as it grows, so large directories
+	// should use a cached or database-backed total instead
+	TotalUsage func(uploadDir string) (int64, error)
+	// MaxUserBytes is the most one user can store. It needs both UserUsage and Tools.UploadUserID
+	MaxUserBytes int64
+	// UserUsage returns how many bytes a user has already stored
+	UserUsage func(userID string) (int64, error)
+}
+
+// quotaUser identifies one user's reservations against an UploadQuota
+type quotaUser struct {
+	quota  *UploadQuota
+	userID string
+}
+
+// quotaReservations holds the bytes reserved by uploads which are still being written, so they count
+// against the quota before they show up in TotalUsage or UserUsage. Entries are removed once they
+// drop back to zero. A file that has been written but not yet released is counted twice, which only
+// ever errs on the side of refusing an upload
+var quotaReservations = struct {
+	sync.Mutex
+	total map[*UploadQuota]int64
+	users map[quotaUser]int64
+}{
+	total: make(map[*UploadQuota]int64),
+	users: make(map[quotaUser]int64),
+}
+
+// quotaUsage tracks what one call to UploadFiles has reserved against the quota
+type quotaUsage struct {
+	quota    *UploadQuota
+	total    int64
+	user     int64
+	userID   string
+	reserved int64
+}
+
+// newQuotaUsage works out how much of the quota is already used, or returns nil if there's no quota
+func (t *Tools) newQuotaUsage(r *http.Request, uploadDir string) (*quotaUsage, error) {
+	if t.UploadQuota == nil {
+		return nil, nil
+	}
+
+	u := &quotaUsage{quota: t.UploadQuota}
+
+	if u.quota.MaxTotalBytes > 0 {
+		totalUsage := u.quota.TotalUsage
+		if totalUsage == nil {
+			totalUsage = func(dir string) (int64, error) {
+				total, _, err := dirUsage(dir)
+				return total, err
+			}
+		}
+
+		total, err := totalUsage(uploadDir)
+		if err != nil {
+			return nil, err
+		}
+		u.total = total
+	}
+
+	if u.quota.MaxUserBytes > 0 && u.quota.UserUsage != nil && t.UploadUserID != nil {
+		u.userID = t.UploadUserID(r)
+
+		used, err := u.quota.UserUsage(u.userID)
+		if err != nil {
+			return nil, err
+		}
+		u.user = used
+	}
+
+	return u, nil
+}
+
+// reserve sets size aside for a file about to be written, or returns ErrQuotaExceeded if that, on top
+// of what's stored and what other uploads have reserved, would go over a limit
+func (u *quotaUsage) reserve(size int64) error {
+	if u == nil {
+		return nil
+	}
+
+	quotaReservations.Lock()
+	defer quotaReservations.Unlock()
+
+	user := quotaUser{quota: u.quota, userID: u.userID}
+
+	if u.quota.MaxTotalBytes > 0 && u.total+quotaReservations.total[u.quota]+size > u.quota.MaxTotalBytes {
+		return fmt.Errorf("%w: the upload directory is full", ErrQuotaExceeded)
+	}
+
+	if u.quota.MaxUserBytes > 0 && u.userID != "" && u.user+quotaReservations.users[user]+size > u.quota.MaxUserBytes {
+		return fmt.Errorf("%w: user %s has used their quota", ErrQuotaExceeded, u.userID)
+	}
+
+	quotaReservations.total[u.quota] += size
+	if u.userID != "" {
+		quotaReservations.users[user] += size
+	}
+	u.reserved += size
+	return nil
+}
+
+// release gives back everything reserved, once the files are written and will be counted by
+// TotalUsage and UserUsage instead
+func (u *quotaUsage) release() {
+	if u == nil || u.reserved == 0 {
+		return
+	}
+
+	quotaReservations.Lock()
+	defer quotaReservations.Unlock()
+
+	if quotaReservations.total[u.quota] -= u.reserved; quotaReservations.total[u.quota] <= 0 {
+		delete(quotaReservations.total, u.quota)
+	}
+
+	if u.userID != "" {
+		user := quotaUser{quota: u.quota, userID: u.userID}
+		if quotaReservations.users[user] -= u.reserved; quotaReservations.users[user] <= 0 {
+			delete(quotaReservations.users, user)
+		}
+	}
+
+	u.reserved = 0
+}
+
+// SweptFile is a file removed, or which would be removed in a dry run, by a Sweeper
+type SweptFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Reason  string
+}
+
+// Reasons a file is swept
+const (
+	SweepExpired   = "expired"
+	SweepOverQuota = "over quota"
+)
+
+// SweepReport describes what a sweep did
+type SweepReport struct {
+	DryRun         bool
+	Removed        []SweptFile
+	RemovedBytes   int64
+	RemainingFiles int
+	RemainingBytes int64
+}
+
+// Sweeper deletes old files from an upload directory. Files older than TTL are removed, then the
+// oldest files are removed until the directory holds no more than MaxTotalBytes. Dotfiles and
+// anything in dot directories are never touched
+type Sweeper struct {
+	Dir           string
+	TTL           time.Duration
+	MaxTotalBytes int64
+	// Metadata, if set, has the metadata for each removed file deleted too
+	Metadata MetadataStore
+	// Interval is how often Run sweeps, 1 hour if zero
+	Interval time.Duration
+	// DryRun reports what would be removed without removing anything
+	DryRun bool
+	// OnSweep is called by Run after every sweep
+	OnSweep func(report *SweepReport, err error)
+}
+
+// Sweep makes one pass over Dir. Files which can't be removed are left in the remaining totals, and
+// the errors are returned together with the report
+func (s *Sweeper) Sweep() (*SweepReport, error) {
+	report := &SweepReport{DryRun: s.DryRun}
+
+	var files []SweptFile
+	err := walkUploads(s.Dir, func(path string, info fs.FileInfo) {
+		files = append(files, SweptFile{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+		report.RemainingBytes += info.Size()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime.Before(files[j].ModTime)
+	})
+
+	var errs []error
+	cutoff := time.Now().Add(-s.TTL)
+
+	for _, f := range files {
+		switch {
+		case s.TTL > 0 && f.ModTime.Before(cutoff):
+			f.Reason = SweepExpired
+		case s.MaxTotalBytes > 0 && report.RemainingBytes > s.MaxTotalBytes:
+			f.Reason = SweepOverQuota
+		default:
+			report.RemainingFiles++
+			continue
+		}
+
+		if !s.DryRun {
+			if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+				report.RemainingFiles++
+				continue
+			}
+
+			if s.Metadata != nil {
+				if err := s.Metadata.Delete(filepath.Base(f.Path)); err != nil && !errors.Is(err, ErrMetadataNotFound) {
+					errs = append(errs, err)
+				}
+			}
+		}
+
+		report.Removed = append(report.Removed, f)
+		report.RemovedBytes += f.Size
+		report.RemainingBytes -= f.Size
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// Run sweeps straight away and then every Interval until ctx is done
+func (s *Sweeper) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval == 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Sweep()
+		if s.OnSweep != nil {
+			s.OnSweep(report, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// walkUploads calls fn for every regular file under dir, skipping dotfiles and dot directories
+func walkUploads(dir string, fn func(path string, info fs.FileInfo)) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fn(path, info)
+		return nil
+	})
+}
+
+// dirUsage returns the total size and number of uploaded files in dir. A missing dir is empty
+func dirUsage(dir string) (int64, int, error) {
+	var size int64
+	var count int
+
+	err := walkUploads(dir, func(path string, info fs.FileInfo) {
+		size += info.Size()
+		count++
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+
+	return size, count, err
+}
@@ -0,0 +1,269 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newUploadRequest returns a multipart request with a file field for each of files
+func newUploadRequest(t *testing.T, files map[string]string) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write([]byte(content))
+	}
+	writer.Close()
+
+	request := httptest.NewRequest("POST", "/", body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+var uploadQuotaTests = []struct {
+	name          string
+	existing      int
+	files         map[string]string
+	quota         UploadQuota
+	userUsage     int64
+	errorExpected bool
+}{
+	{name: "no limits", files: map[string]string{"a.txt": "hello"}},
+	{name: "within total", existing: 10, files: map[string]string{"a.txt": "hello"}, quota: UploadQuota{MaxTotalBytes: 15}},
+	{name: "over total", existing: 11, files: map[string]string{"a.txt": "hello"}, quota: UploadQuota{MaxTotalBytes: 15}, errorExpected: true},
+	{name: "several files over total", files: map[string]string{"a.txt": "hello", "b.txt": "world"}, quota: UploadQuota{MaxTotalBytes: 8}, errorExpected: true},
+	{name: "within user", files: map[string]string{"a.txt": "hello"}, quota: UploadQuota{MaxUserBytes: 10}, userUsage: 5},
+	{name: "over user", files: map[string]string{"a.txt": "hello"}, quota: UploadQuota{MaxUserBytes: 10}, userUsage: 6, errorExpected: true},
+}
+
+func TestTools_UploadQuota(t *testing.T) {
+	for _, e := range uploadQuotaTests {
+		dir := t.TempDir()
+		if e.existing > 0 {
+			_ = os.WriteFile(filepath.Join(dir, "existing"), bytes.Repeat([]byte("x"), e.existing), 0644)
+		}
+
+		var askedFor string
+		quota := e.quota
+		quota.UserUsage = func(userID string) (int64, error) {
+			askedFor = userID
+			return e.userUsage, nil
+		}
+
+		tool := Tools{
+			UploadQuota: &quota,
+			UploadUserID: func(r *http.Request) string {
+				return "user-1"
+			},
+		}
+
+		_, err := tool.UploadFiles(newUploadRequest(t, e.files), dir)
+
+		if e.errorExpected && !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("%s: expected ErrQuotaExceeded but got %v", e.name, err)
+		}
+
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if e.quota.MaxUserBytes > 0 && askedFor != "user-1" {
+			t.Errorf("%s: user usage asked for %q", e.name, askedFor)
+		}
+	}
+}
+
+func TestTools_UploadQuotaTotalUsage(t *testing.T) {
+	var askedFor string
+	tool := Tools{UploadQuota: &UploadQuota{MaxTotalBytes: 100, TotalUsage: func(uploadDir string) (int64, error) {
+		askedFor = uploadDir
+		return 96, nil
+	}}}
+
+	dir := t.TempDir()
+	_, err := tool.UploadFiles(newUploadRequest(t, map[string]string{"a.txt": "hello"}), dir)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded from TotalUsage but got %v", err)
+	}
+
+	if askedFor != dir {
+		t.Errorf("total usage asked for %q", askedFor)
+	}
+}
+
+func TestTools_UploadQuotaConcurrentReservations(t *testing.T) {
+	tool := Tools{
+		UploadQuota: &UploadQuota{MaxTotalBytes: 10, MaxUserBytes: 8, UserUsage: func(userID string) (int64, error) {
+			return 0, nil
+		}},
+		UploadUserID: func(r *http.Request) string {
+			return r.Header.Get("X-User")
+		},
+	}
+
+	newUsage := func(user string) *quotaUsage {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("X-User", user)
+		u, err := tool.newQuotaUsage(r, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	// both uploads see an empty directory, but the second has to count what the first has reserved
+	first, second := newUsage("a"), newUsage("b")
+
+	if err := first.reserve(6); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.reserve(6); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected the total reserved by another upload to count but got %v", err)
+	}
+
+	// the same user uploading twice at once shares the user quota
+	third := newUsage("a")
+	if err := third.reserve(3); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected the user's other upload to count but got %v", err)
+	}
+
+	first.release()
+
+	if err := second.reserve(6); err != nil {
+		t.Errorf("expected the released bytes to be available but got %s", err)
+	}
+	second.release()
+
+	quotaReservations.Lock()
+	defer quotaReservations.Unlock()
+	if len(quotaReservations.total) != 0 || len(quotaReservations.users) != 0 {
+		t.Errorf("reservations left behind: %v %v", quotaReservations.total, quotaReservations.users)
+	}
+}
+
+// writeAged writes a file of size bytes last modified age ago
+func writeAged(t *testing.T, path string, size int, age time.Duration) {
+	t.Helper()
+
+	_ = os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweeper_Sweep(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, filepath.Join(dir, "ancient"), 10, 48*time.Hour)
+	writeAged(t, filepath.Join(dir, "sub", "old"), 10, 3*time.Hour)
+	writeAged(t, filepath.Join(dir, "older"), 10, 2*time.Hour)
+	writeAged(t, filepath.Join(dir, "new"), 10, time.Minute)
+	writeAged(t, filepath.Join(dir, ".hidden"), 10, 72*time.Hour)
+	writeAged(t, filepath.Join(dir, ".meta", "ancient"), 10, 72*time.Hour)
+
+	sweeper := &Sweeper{Dir: dir, TTL: 24 * time.Hour, MaxTotalBytes: 20, DryRun: true}
+
+	report, err := sweeper.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range report.Removed {
+		names = append(names, filepath.Base(f.Path)+":"+f.Reason)
+	}
+
+	expected := "ancient:expired old:over quota"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("expected %s but got %s", expected, strings.Join(names, " "))
+	}
+
+	if report.RemovedBytes != 20 || report.RemainingBytes != 20 || report.RemainingFiles != 2 || !report.DryRun {
+		t.Errorf("wrong report: %+v", report)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "ancient")); err != nil {
+		t.Error("dry run removed a file")
+	}
+
+	sweeper.DryRun = false
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"ancient", "sub/old"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+
+	for _, name := range []string{"older", "new", ".hidden", ".meta/ancient"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should not have been removed", name)
+		}
+	}
+}
+
+func TestSweeper_Run(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, filepath.Join(dir, "old"), 10, 2*time.Hour)
+
+	reports := make(chan *SweepReport, 10)
+	sweeper := &Sweeper{
+		Dir:      dir,
+		TTL:      time.Hour,
+		Interval: 10 * time.Millisecond,
+		OnSweep: func(report *SweepReport, err error) {
+			select {
+			case reports <- report:
+			default:
+			}
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- sweeper.Run(ctx)
+	}()
+
+	first := <-reports
+	if len(first.Removed) != 1 {
+		t.Errorf("expected the first sweep to remove the old file, got %+v", first)
+	}
+
+	// a file which expires later is picked up by a later sweep
+	writeAged(t, filepath.Join(dir, "later"), 10, 2*time.Hour)
+
+	removed := false
+	for i := 0; i < 100 && !removed; i++ {
+		removed = len((<-reports).Removed) == 1
+	}
+	if !removed {
+		t.Error("later sweeps didn't remove the new file")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Run to return context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how calls to remote servers are retried. Network errors, 429 and 5xx
+// responses are retried by default, waiting an exponentially growing, jittered delay between
+// attempts unless the server asks for a specific delay with Retry-After
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Defaults to 3
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubling for each one after. Defaults to 100ms
+	BaseDelay time.Duration
+	// MaxDelay caps any single delay, including one asked for with Retry-After. Defaults to 10s
+	MaxDelay time.Duration
+	// MaxElapsed stops retrying once another attempt would finish after this much time. 0 means no limit
+	MaxElapsed time.Duration
+	// IdempotencyHeader is the header used to send the idempotency key. Defaults to Idempotency-Key
+	IdempotencyHeader string
+	// DisableIdempotencyKey stops a key being generated and sent
+	DisableIdempotencyKey bool
+	// RetryOn decides whether an attempt should be retried. resp is nil when err is not
+	RetryOn func(resp *http.Response, err error) bool
+}
+
+// idempotencyKey returns the key sent with every attempt of a single logical call, or an empty
+// string if no key should be sent. It always uses AlphabetURLSafe rather than RandomStringAlphabet, so
+// the key is a valid ASCII header value whatever alphabet the Tools were given
+func (p *RetryPolicy) idempotencyKey(t *Tools) (string, error) {
+	if p == nil || p.DisableIdempotencyKey {
+		return "", nil
+	}
+	return t.RandomStringFrom(32, AlphabetURLSafe)
+}
+
+func (p *RetryPolicy) idempotencyHeader() string {
+	if p == nil || p.IdempotencyHeader == "" {
+		return "Idempotency-Key"
+	}
+	return p.IdempotencyHeader
+}
+
+// do sends the request built by newRequest with send until it succeeds, can't be retried, the circuit
+// breaker opens or the policy runs out of attempts. A new request is built for every attempt so the
+// body can be sent again. With a nil policy the request is sent exactly once. Waiting between attempts
+// stops as soon as ctx is done
+func (p *RetryPolicy) do(ctx context.Context, send func(*http.Request) (*http.Response, error), newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if p == nil {
+		request, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		return send(request)
+	}
+
+	maxAttempts := 3
+	if p.MaxAttempts > 0 {
+		maxAttempts = p.MaxAttempts
+	}
+
+	retryOn := defaultRetryOn
+	if p.RetryOn != nil {
+		retryOn = p.RetryOn
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		request, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := send(request)
+		if attempt >= maxAttempts || errors.Is(err, ErrCircuitOpen) || !retryOn(response, err) {
+			return response, err
+		}
+
+		delay := p.delay(attempt, response)
+		if p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed {
+			return response, err
+		}
+
+		if response != nil {
+			// drain the body so the connection can be reused for the next attempt
+			_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// delay works out how long to wait before retrying after the given attempt, using full jitter so
+// many clients retrying at once don't all hit the server together
+func (p *RetryPolicy) delay(attempt int, response *http.Response) time.Duration {
+	base := 100 * time.Millisecond
+	if p.BaseDelay > 0 {
+		base = p.BaseDelay
+	}
+
+	maxDelay := 10 * time.Second
+	if p.MaxDelay > 0 {
+		maxDelay = p.MaxDelay
+	}
+
+	if response != nil {
+		if d, ok := retryAfter(response.Header.Get("Retry-After")); ok {
+			return min(d, maxDelay)
+		}
+	}
+
+	backoff := maxDelay
+	if attempt < 32 && base<<(attempt-1) < maxDelay {
+		backoff = base << (attempt - 1)
+	}
+
+	return rand.N(backoff) + 1
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+
+	if when, err := http.ParseTime(header); err == nil {
+		return max(time.Until(when), 0), true
+	}
+
+	return 0, false
+}
+
+// defaultRetryOn retries network errors, 429 Too Many Requests and server errors other than
+// 501 Not Implemented, which won't go away by asking again
+func defaultRetryOn(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return response.StatusCode == http.StatusTooManyRequests ||
+		(response.StatusCode >= 500 && response.StatusCode != http.StatusNotImplemented)
+}
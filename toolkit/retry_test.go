@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var retryTests = []struct {
+	name             string
+	statuses         []int
+	retryAfter       string
+	policy           *RetryPolicy
+	expectedAttempts int
+	expectedStatus   int
+}{
+	{name: "no policy", statuses: []int{503, 200}, policy: nil, expectedAttempts: 1, expectedStatus: 503},
+	{name: "succeeds after retries", statuses: []int{503, 500, 200}, policy: &RetryPolicy{BaseDelay: time.Millisecond}, expectedAttempts: 3, expectedStatus: 200},
+	{name: "gives up after max attempts", statuses: []int{503, 503, 503, 503}, policy: &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}, expectedAttempts: 2, expectedStatus: 503},
+	{name: "too many requests", statuses: []int{429, 200}, policy: &RetryPolicy{BaseDelay: time.Millisecond}, expectedAttempts: 2, expectedStatus: 200},
+	{name: "client error not retried", statuses: []int{400, 200}, policy: &RetryPolicy{BaseDelay: time.Millisecond}, expectedAttempts: 1, expectedStatus: 400},
+	{name: "not implemented not retried", statuses: []int{501, 200}, policy: &RetryPolicy{BaseDelay: time.Millisecond}, expectedAttempts: 1, expectedStatus: 501},
+	{name: "retry after is capped", statuses: []int{503, 200}, retryAfter: "3600", policy: &RetryPolicy{MaxDelay: time.Millisecond}, expectedAttempts: 2, expectedStatus: 200},
+	{name: "max elapsed", statuses: []int{503, 200}, retryAfter: "1", policy: &RetryPolicy{MaxElapsed: 100 * time.Millisecond}, expectedAttempts: 1, expectedStatus: 503},
+	{name: "custom retry on", statuses: []int{409, 200}, policy: &RetryPolicy{BaseDelay: time.Millisecond, RetryOn: func(resp *http.Response, err error) bool {
+		return err == nil && resp.StatusCode == http.StatusConflict
+	}}, expectedAttempts: 2, expectedStatus: 200},
+}
+
+func TestTools_PushJSONToRemoteRetries(t *testing.T) {
+	for _, e := range retryTests {
+		var mu sync.Mutex
+		var keys []string
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			keys = append(keys, r.Header.Get("Idempotency-Key"))
+			if e.retryAfter != "" {
+				w.Header().Set("Retry-After", e.retryAfter)
+			}
+			w.WriteHeader(e.statuses[len(keys)-1])
+		}))
+
+		tool := &Tools{RemoteRetry: e.policy}
+
+		_, status, err := tool.PushJSONToRemote(srv.URL, map[string]string{"foo": "bar"})
+		srv.Close()
+
+		if err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if status != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, status)
+		}
+
+		if len(keys) != e.expectedAttempts {
+			t.Errorf("%s: expected %d attempts but got %d", e.name, e.expectedAttempts, len(keys))
+		}
+
+		for _, key := range keys {
+			if e.policy == nil && key != "" {
+				t.Errorf("%s: idempotency key sent without a retry policy", e.name)
+			}
+			if e.policy != nil && (key == "" || key != keys[0]) {
+				t.Errorf("%s: expected the same idempotency key on every attempt, got %v", e.name, keys)
+				break
+			}
+		}
+	}
+}
+
+func TestTools_PushJSONToRemoteIdempotencyKeyAlphabet(t *testing.T) {
+	for _, alphabet := range []string{"äöüßéñ", "a"} {
+		var key string
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key = r.Header.Get("Idempotency-Key")
+		}))
+
+		// the key doesn't depend on RandomStringAlphabet, so neither alphabet can panic or leak into the header
+		tool := &Tools{RemoteRetry: &RetryPolicy{}, RandomStringAlphabet: alphabet}
+
+		_, _, err := tool.PushJSONToRemote(srv.URL, map[string]string{"foo": "bar"})
+		srv.Close()
+
+		if err != nil {
+			t.Errorf("%q: error not expected but one received: %s", alphabet, err.Error())
+		}
+
+		if len(key) != 32 || strings.Trim(key, AlphabetURLSafe) != "" {
+			t.Errorf("%q: expected a URL safe idempotency key but got %q", alphabet, key)
+		}
+	}
+}
+
+func TestTools_PushJSONToRemoteRetriesNetworkErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	tool := &Tools{RemoteRetry: &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}}
+
+	_, _, err := tool.PushJSONToRemote(url, map[string]string{"foo": "bar"})
+	if err == nil {
+		t.Error("expected an error calling a closed server")
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	for attempt := 1; attempt <= 40; attempt++ {
+		d := policy.delay(attempt, nil)
+		if d <= 0 || d > 50*time.Millisecond {
+			t.Errorf("attempt %d: delay %s out of range", attempt, d)
+		}
+	}
+
+	response := &http.Response{Header: http.Header{"Retry-After": []string{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}}
+	if d := policy.delay(1, response); d != 50*time.Millisecond {
+		t.Errorf("expected Retry-After date to be capped at 50ms, got %s", d)
+	}
+}
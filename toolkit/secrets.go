@@ -0,0 +1,256 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Secret is a generated secret along with an estimate of how hard it is to guess
+type Secret struct {
+	Value       string
+	EntropyBits float64
+}
+
+// ErrInvalidAPIKey is returned by ValidateAPIKey when a key is malformed or its checksum doesn't match
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+const (
+	apiKeyRandomLength   = 30
+	apiKeyChecksumLength = 6
+)
+
+var apiKeyPrefixRe = regexp.MustCompile(`^[a-zA-Z0-9]*$`)
+
+// NewAPIKey returns an API key made of prefix, an underscore, 30 random letters and digits and a 6
+// character checksum, such as "live_...". The prefix makes keys easy to spot in logs and code, and the
+// checksum lets ValidateAPIKey reject typos and made up keys without a database lookup
+func (t *Tools) NewAPIKey(prefix string) (Secret, error) {
+	if !apiKeyPrefixRe.MatchString(prefix) {
+		return Secret{}, errors.New("API key prefix can only contain letters and digits")
+	}
+
+	random, err := t.RandomStringFrom(apiKeyRandomLength, AlphabetAlphanumeric)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	key := random + apiKeyChecksum(prefix, random)
+	if prefix != "" {
+		key = prefix + "_" + key
+	}
+
+	return Secret{
+		Value:       key,
+		EntropyBits: entropyBits(apiKeyRandomLength, len(AlphabetAlphanumeric)),
+	}, nil
+}
+
+// ValidateAPIKey checks that key is well formed and that its checksum matches. If a prefix is given
+// the key must also start with it
+func (t *Tools) ValidateAPIKey(key string, prefix ...string) error {
+	keyPrefix, body := "", key
+	if i := strings.LastIndexByte(key, '_'); i >= 0 {
+		keyPrefix, body = key[:i], key[i+1:]
+	}
+
+	if len(prefix) > 0 && keyPrefix != prefix[0] {
+		return fmt.Errorf("%w: wrong prefix", ErrInvalidAPIKey)
+	}
+
+	if !apiKeyPrefixRe.MatchString(keyPrefix) || !apiKeyPrefixRe.MatchString(body) || len(body) != apiKeyRandomLength+apiKeyChecksumLength {
+		return fmt.Errorf("%w: malformed", ErrInvalidAPIKey)
+	}
+
+	random, checksum := body[:apiKeyRandomLength], body[apiKeyRandomLength:]
+	if apiKeyChecksum(keyPrefix, random) != checksum {
+		return fmt.Errorf("%w: checksum does not match", ErrInvalidAPIKey)
+	}
+
+	return nil
+}
+
+// apiKeyChecksum is the CRC32 of the prefix and random part, in base 62 so it fits in 6 characters
+func apiKeyChecksum(prefix, random string) string {
+	sum := crc32.ChecksumIEEE([]byte(prefix + "_" + random))
+
+	var buf [apiKeyChecksumLength]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = AlphabetAlphanumeric[sum%uint32(len(AlphabetAlphanumeric))]
+		sum /= uint32(len(AlphabetAlphanumeric))
+	}
+	return string(buf[:])
+}
+
+// NewOTP returns a numeric one time code of digits digits, 6 if none is given
+func (t *Tools) NewOTP(digits ...int) (Secret, error) {
+	n := 6
+	if len(digits) > 0 {
+		n = digits[0]
+	}
+
+	if n < 4 {
+		return Secret{}, errors.New("one time codes must have at least 4 digits")
+	}
+
+	code, err := t.RandomStringFrom(n, "0123456789")
+	if err != nil {
+		return Secret{}, err
+	}
+
+	return Secret{Value: code, EntropyBits: entropyBits(n, 10)}, nil
+}
+
+// NewPassphrase returns words random words from a built in list, joined with separator, or "-" if no
+// separator is given
+func (t *Tools) NewPassphrase(words int, separator ...string) (Secret, error) {
+	sep := "-"
+	if len(separator) > 0 {
+		sep = separator[0]
+	}
+
+	if words < 1 {
+		return Secret{}, errors.New("a passphrase needs at least one word")
+	}
+
+	chosen := make([]string, words)
+	for i := range chosen {
+		n, err := randomIndex(len(passphraseWords))
+		if err != nil {
+			return Secret{}, err
+		}
+		chosen[i] = passphraseWords[n]
+	}
+
+	return Secret{
+		Value:       strings.Join(chosen, sep),
+		EntropyBits: entropyBits(words, len(passphraseWords)),
+	}, nil
+}
+
+// Character classes used by PasswordPolicy
+const (
+	passwordLower     = "abcdefghijklmnopqrstuvwxyz"
+	passwordUpper     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	passwordDigits    = "0123456789"
+	passwordSymbols   = "!@#$%^&*()-_=+[]{};:,.?"
+	passwordAmbiguous = "0O1lI"
+)
+
+// PasswordPolicy describes the passwords made by NewPassword. The zero value makes 16 character
+// passwords from letters, digits and symbols with no minimum for any class
+type PasswordPolicy struct {
+	Length           int
+	MinLower         int
+	MinUpper         int
+	MinDigits        int
+	MinSymbols       int
+	Symbols          string
+	NoSymbols        bool
+	ExcludeAmbiguous bool
+}
+
+// NewPassword returns a password meeting policy, or the default policy if none is given
+func (t *Tools) NewPassword(policy ...PasswordPolicy) (Secret, error) {
+	var p PasswordPolicy
+	if len(policy) > 0 {
+		p = policy[0]
+	}
+
+	if p.Length == 0 {
+		p.Length = 16
+	}
+
+	symbols := passwordSymbols
+	if p.Symbols != "" {
+		symbols = p.Symbols
+	}
+	if p.NoSymbols {
+		if p.MinSymbols > 0 {
+			return Secret{}, errors.New("password policy requires symbols but doesn't allow them")
+		}
+		symbols = ""
+	}
+
+	if p.MinLower+p.MinUpper+p.MinDigits+p.MinSymbols > p.Length {
+		return Secret{}, fmt.Errorf("password policy needs more than %d characters", p.Length)
+	}
+
+	classes := []struct {
+		chars string
+		min   int
+	}{
+		{passwordLower, p.MinLower},
+		{passwordUpper, p.MinUpper},
+		{passwordDigits, p.MinDigits},
+		{symbols, p.MinSymbols},
+	}
+
+	var pool strings.Builder
+	for i := range classes {
+		if p.ExcludeAmbiguous {
+			classes[i].chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(passwordAmbiguous, r) {
+					return -1
+				}
+				return r
+			}, classes[i].chars)
+		}
+		pool.WriteString(classes[i].chars)
+	}
+
+	// the minimum from each class is chosen first, then the rest come from every class, and the
+	// whole lot is shuffled so the required characters aren't always at the front
+	var password []rune
+	var bits float64
+	for _, c := range classes {
+		if c.min == 0 {
+			continue
+		}
+
+		s, err := t.RandomStringFrom(c.min, c.chars)
+		if err != nil {
+			return Secret{}, err
+		}
+		password = append(password, []rune(s)...)
+		bits += entropyBits(c.min, utf8.RuneCountInString(c.chars))
+	}
+
+	rest := p.Length - len(password)
+	s, err := t.RandomStringFrom(rest, pool.String())
+	if err != nil {
+		return Secret{}, err
+	}
+	password = append(password, []rune(s)...)
+	bits += entropyBits(rest, utf8.RuneCountInString(pool.String()))
+
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return Secret{}, err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return Secret{Value: string(password), EntropyBits: bits}, nil
+}
+
+// randomIndex returns a uniformly chosen number from 0 to n-1
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("unable to read random data: %w", err)
+	}
+	return int(i.Int64()), nil
+}
+
+// entropyBits is the entropy of n characters each chosen uniformly from size possibilities
+func entropyBits(n, size int) float64 {
+	return float64(n) * math.Log2(float64(size))
+}
@@ -0,0 +1,228 @@
+package toolkit
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestTools_APIKey(t *testing.T) {
+	var tool Tools
+
+	key, err := tool.NewAPIKey("live")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^live_[a-zA-Z0-9]{36}$`).MatchString(key.Value) {
+		t.Errorf("wrong API key format: %q", key.Value)
+	}
+
+	if math.Abs(key.EntropyBits-178.6) > 0.1 {
+		t.Errorf("wrong entropy: %f", key.EntropyBits)
+	}
+
+	if err := tool.ValidateAPIKey(key.Value); err != nil {
+		t.Errorf("generated key should be valid: %s", err)
+	}
+
+	if err := tool.ValidateAPIKey(key.Value, "live"); err != nil {
+		t.Errorf("generated key should be valid with its prefix: %s", err)
+	}
+
+	unprefixed, _ := tool.NewAPIKey("")
+	if strings.Contains(unprefixed.Value, "_") || tool.ValidateAPIKey(unprefixed.Value) != nil {
+		t.Errorf("wrong unprefixed key: %q", unprefixed.Value)
+	}
+
+	// change one character of the random part
+	typo := []byte(key.Value)
+	if typo[5] == 'a' {
+		typo[5] = 'b'
+	} else {
+		typo[5] = 'a'
+	}
+
+	invalid := []struct {
+		name   string
+		key    string
+		prefix []string
+	}{
+		{name: "typo", key: string(typo)},
+		{name: "wrong prefix", key: key.Value, prefix: []string{"test"}},
+		{name: "swapped prefix", key: "test" + key.Value[4:]},
+		{name: "truncated", key: key.Value[:len(key.Value)-1]},
+		{name: "bad characters", key: "live_" + strings.Repeat("!", 36)},
+		{name: "empty", key: ""},
+	}
+
+	for _, e := range invalid {
+		if err := tool.ValidateAPIKey(e.key, e.prefix...); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("%s: expected ErrInvalidAPIKey but got %v", e.name, err)
+		}
+	}
+
+	if _, err := tool.NewAPIKey("bad_prefix"); err == nil {
+		t.Error("expected an error for a prefix with an underscore")
+	}
+}
+
+func TestTools_NewOTP(t *testing.T) {
+	var tool Tools
+
+	code, err := tool.NewOTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^[0-9]{6}$`).MatchString(code.Value) {
+		t.Errorf("wrong code: %q", code.Value)
+	}
+
+	if math.Abs(code.EntropyBits-19.93) > 0.01 {
+		t.Errorf("wrong entropy: %f", code.EntropyBits)
+	}
+
+	if code, _ := tool.NewOTP(8); len(code.Value) != 8 {
+		t.Errorf("expected 8 digits, got %q", code.Value)
+	}
+
+	if _, err := tool.NewOTP(3); err == nil {
+		t.Error("expected an error for a 3 digit code")
+	}
+}
+
+func TestTools_NewPassphrase(t *testing.T) {
+	var tool Tools
+
+	phrase, err := tool.NewPassphrase(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	words := strings.Split(phrase.Value, "-")
+	if len(words) != 6 {
+		t.Fatalf("expected 6 words, got %q", phrase.Value)
+	}
+
+	for _, w := range words {
+		found := false
+		for _, listed := range passphraseWords {
+			if w == listed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%q isn't in the word list", w)
+		}
+	}
+
+	if phrase.EntropyBits != 54 {
+		t.Errorf("expected 54 bits of entropy, got %f", phrase.EntropyBits)
+	}
+
+	if phrase, _ := tool.NewPassphrase(3, " "); len(strings.Split(phrase.Value, " ")) != 3 {
+		t.Errorf("wrong separator used: %q", phrase.Value)
+	}
+
+	if _, err := tool.NewPassphrase(0); err == nil {
+		t.Error("expected an error for no words")
+	}
+}
+
+func TestPassphraseWords(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, w := range passphraseWords {
+		if seen[w] {
+			t.Errorf("%q is in the word list more than once", w)
+		}
+		seen[w] = true
+	}
+
+	if len(passphraseWords) != 512 {
+		t.Errorf("expected 512 words, got %d", len(passphraseWords))
+	}
+}
+
+var passwordTests = []struct {
+	name          string
+	policy        PasswordPolicy
+	expectedBits  float64
+	errorExpected bool
+}{
+	{name: "default", policy: PasswordPolicy{}, expectedBits: 16 * math.Log2(85)},
+	{name: "minimums", policy: PasswordPolicy{Length: 12, MinLower: 2, MinUpper: 2, MinDigits: 2, MinSymbols: 2}, expectedBits: 2*math.Log2(26)*2 + 2*math.Log2(10) + 2*math.Log2(23) + 4*math.Log2(85)},
+	{name: "no symbols", policy: PasswordPolicy{Length: 20, NoSymbols: true}, expectedBits: 20 * math.Log2(62)},
+	{name: "custom symbols", policy: PasswordPolicy{Length: 10, Symbols: "!?", MinSymbols: 1}, expectedBits: 1 + 9*math.Log2(64)},
+	{name: "exclude ambiguous", policy: PasswordPolicy{Length: 30, ExcludeAmbiguous: true}, expectedBits: 30 * math.Log2(80)},
+	{name: "impossible", policy: PasswordPolicy{Length: 4, MinDigits: 5}, errorExpected: true},
+	{name: "symbols required but not allowed", policy: PasswordPolicy{MinSymbols: 1, NoSymbols: true}, errorExpected: true},
+}
+
+func TestTools_NewPassword(t *testing.T) {
+	var tool Tools
+
+	for _, e := range passwordTests {
+		for i := 0; i < 50; i++ {
+			password, err := tool.NewPassword(e.policy)
+
+			if e.errorExpected {
+				if err == nil {
+					t.Errorf("%s: error expected, but none received", e.name)
+				}
+				break
+			}
+
+			if err != nil {
+				t.Fatalf("%s: error not expected but one received: %s", e.name, err.Error())
+			}
+
+			length := e.policy.Length
+			if length == 0 {
+				length = 16
+			}
+
+			var lower, upper, digits, symbols int
+			for _, r := range password.Value {
+				switch {
+				case unicode.IsLower(r):
+					lower++
+				case unicode.IsUpper(r):
+					upper++
+				case unicode.IsDigit(r):
+					digits++
+				default:
+					symbols++
+				}
+
+				if e.policy.ExcludeAmbiguous && strings.ContainsRune(passwordAmbiguous, r) {
+					t.Errorf("%s: ambiguous character in %q", e.name, password.Value)
+				}
+
+				if e.policy.Symbols != "" && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(e.policy.Symbols, r) {
+					t.Errorf("%s: symbol not in the policy in %q", e.name, password.Value)
+				}
+			}
+
+			if len(password.Value) != length {
+				t.Errorf("%s: expected %d characters, got %q", e.name, length, password.Value)
+			}
+
+			if lower < e.policy.MinLower || upper < e.policy.MinUpper || digits < e.policy.MinDigits || symbols < e.policy.MinSymbols {
+				t.Errorf("%s: %q doesn't meet the policy", e.name, password.Value)
+			}
+
+			if e.policy.NoSymbols && symbols > 0 {
+				t.Errorf("%s: unexpected symbols in %q", e.name, password.Value)
+			}
+
+			if math.Abs(password.EntropyBits-e.expectedBits) > 0.001 {
+				t.Errorf("%s: expected %f bits of entropy but got %f", e.name, e.expectedBits, password.EntropyBits)
+			}
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrReservedSlug is returned by SlugifyWithOptions when the slug is one of the reserved words
+var ErrReservedSlug = errors.New("slug is a reserved word")
+
+// ErrSlugAttemptsExhausted is returned by UniqueSlug when every slug it tried was taken
+var ErrSlugAttemptsExhausted = errors.New("no unique slug found")
+
+// StopWordsEnglish is a list of common English words which can be used as SlugOptions.StopWords
+var StopWordsEnglish = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "from", "in", "into", "is", "it",
+	"of", "on", "or", "so", "than", "that", "the", "then", "to", "was", "with",
+}
+
+// SlugOptions changes how SlugifyWithOptions builds a slug. The zero value gives the same result as
+// Slugify
+type SlugOptions struct {
+	// Separator goes between words, "-" if empty
+	Separator string
+	// MaxLength is the longest slug allowed. Whole words are dropped from the end to fit, and a single
+	// word that is too long on its own is cut short. Zero means no limit
+	MaxLength int
+	// StopWords are left out of the slug, unless that would leave it empty
+	StopWords []string
+	// PreserveCase stops the slug from being lower cased
+	PreserveCase bool
+	// ReservedWords are slugs which can't be used, such as "admin" or "new". They are compared
+	// ignoring case
+	ReservedWords []string
+	// Language overrides SlugLanguage for this slug
+	Language string
+}
+
+// SlugifyWithOptions creates a slug from s, like Slugify, using opts
+func (t *Tools) SlugifyWithOptions(s string, opts SlugOptions) (string, error) {
+	if s == "" {
+		return "", errors.New("empty string not permitted")
+	}
+
+	sep := "-"
+	if opts.Separator != "" {
+		sep = opts.Separator
+	}
+
+	language := t.SlugLanguage
+	if opts.Language != "" {
+		language = opts.Language
+	}
+
+	var b strings.Builder
+	for _, r := range transliterate(s, language) {
+		if v, ok := transliterateASCII[r]; ok {
+			b.WriteString(v)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	s = b.String()
+	if !opts.PreserveCase {
+		s = strings.ToLower(s)
+	}
+
+	// anything that isn't an ASCII letter or digit separates words
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	if len(opts.StopWords) > 0 {
+		var kept []string
+		for _, w := range words {
+			if !containsFold(opts.StopWords, w) {
+				kept = append(kept, w)
+			}
+		}
+
+		if len(kept) > 0 {
+			words = kept
+		}
+	}
+
+	slug := strings.Join(words, sep)
+	if opts.MaxLength > 0 && len(slug) > opts.MaxLength {
+		slug = truncateSlug(words, sep, opts.MaxLength)
+	}
+
+	if len(slug) == 0 {
+		return "", errors.New("after removing characters slug is 0 length")
+	}
+
+	if containsFold(opts.ReservedWords, slug) {
+		return "", fmt.Errorf("%w: %q", ErrReservedSlug, slug)
+	}
+
+	return slug, nil
+}
+
+// SlugExistsFunc reports whether slug is already in use
+type SlugExistsFunc func(ctx context.Context, slug string) (bool, error)
+
+// SlugSet returns a SlugExistsFunc which reports the given slugs as taken
+func SlugSet(slugs ...string) SlugExistsFunc {
+	set := make(map[string]bool, len(slugs))
+	for _, s := range slugs {
+		set[s] = true
+	}
+
+	return func(ctx context.Context, slug string) (bool, error) {
+		return set[slug], nil
+	}
+}
+
+// UniqueSlugOptions changes how UniqueSlug builds and numbers slugs
+type UniqueSlugOptions struct {
+	SlugOptions
+	// RandomSuffix uses a random suffix such as "title-x7k2qp" instead of counting up from "title-2"
+	RandomSuffix bool
+	// SuffixLength is the length of a random suffix, 6 if zero
+	SuffixLength int
+	// MaxAttempts is how many slugs are tried before giving up, 100 if zero
+	MaxAttempts int
+}
+
+// UniqueSlug returns a slug for s which exists reports as not taken. The plain slug is tried first,
+// then "slug-2", "slug-3" and so on, or random suffixes if opts.RandomSuffix is set. When MaxLength is
+// set the slug is shortened to leave room for the suffix, and a slug which is a reserved word is treated
+// as taken, so "new" becomes "new-2"
+func (t *Tools) UniqueSlug(ctx context.Context, s string, exists SlugExistsFunc, opts ...UniqueSlugOptions) (string, error) {
+	var o UniqueSlugOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.SuffixLength == 0 {
+		o.SuffixLength = 6
+	}
+
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = 100
+	}
+
+	sep := "-"
+	if o.Separator != "" {
+		sep = o.Separator
+	}
+
+	for attempt := 1; attempt <= o.MaxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		var suffix string
+		switch {
+		case attempt == 1:
+		case o.RandomSuffix:
+			random, err := t.RandomStringFrom(o.SuffixLength, "abcdefghijklmnopqrstuvwxyz0123456789")
+			if err != nil {
+				return "", err
+			}
+			suffix = sep + random
+		default:
+			suffix = sep + strconv.Itoa(attempt)
+		}
+
+		slugOpts := o.SlugOptions
+		slugOpts.ReservedWords = nil
+		if slugOpts.MaxLength > 0 {
+			if slugOpts.MaxLength -= len(suffix); slugOpts.MaxLength <= 0 {
+				return "", fmt.Errorf("max length %d is too short for suffix %q", o.MaxLength, suffix)
+			}
+		}
+
+		slug, err := t.SlugifyWithOptions(s, slugOpts)
+		if err != nil {
+			return "", err
+		}
+		slug += suffix
+
+		if containsFold(o.ReservedWords, slug) {
+			continue
+		}
+
+		taken, err := exists(ctx, slug)
+		if err != nil {
+			return "", err
+		}
+
+		if !taken {
+			return slug, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w after %d attempts", ErrSlugAttemptsExhausted, o.MaxAttempts)
+}
+
+// truncateSlug joins as many whole words as fit in max, or cuts the first word short if it doesn't
+// fit by itself
+func truncateSlug(words []string, sep string, max int) string {
+	if len(words[0]) >= max {
+		return words[0][:max]
+	}
+
+	slug := words[0]
+	for _, w := range words[1:] {
+		if len(slug)+len(sep)+len(w) > max {
+			break
+		}
+		slug += sep + w
+	}
+	return slug
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transliterate replaces accented Latin letters, Cyrillic, Greek and common symbols in s with plain
+// ASCII equivalents, so "Crème Brûlée" becomes "Creme Brulee". If SlugLanguage is set and there is a
+// table for that language it takes priority, so German "ü" becomes "ue" rather than "u". Characters
+// with no equivalent are left alone
+func (t *Tools) Transliterate(s string) string {
+	return transliterate(s, t.SlugLanguage)
+}
+
+func transliterate(s, lang string) string {
+	language := slugLanguages[strings.ToLower(lang)]
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+
+		if v, ok := language[r]; ok {
+			b.WriteString(v)
+		} else if v, ok := transliterations[r]; ok {
+			b.WriteString(v)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// transliterations is used for every language. The tables only list lower case letters, the upper
+// case ones are added by withUpper
+var transliterations = withUpper(
+	map[rune]string{
+		// Latin-1 Supplement
+		'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae", 'ç': "c",
+		'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+		'ð': "d", 'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+		'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'þ': "th", 'ÿ': "y", 'ß': "ss",
+
+		// Latin Extended-A, and the Romanian comma below letters
+		'ā': "a", 'ă': "a", 'ą': "a", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c", 'ď': "d",
+		'đ': "d", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e", 'ĝ': "g", 'ğ': "g",
+		'ġ': "g", 'ģ': "g", 'ĥ': "h", 'ħ': "h", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i",
+		'ı': "i", 'ĳ': "ij", 'ĵ': "j", 'ķ': "k", 'ĸ': "k", 'ĺ': "l", 'ļ': "l", 'ľ': "l",
+		'ŀ': "l", 'ł': "l", 'ń': "n", 'ņ': "n", 'ň': "n", 'ŉ': "n", 'ŋ': "ng", 'ō': "o",
+		'ŏ': "o", 'ő': "o", 'œ': "oe", 'ŕ': "r", 'ŗ': "r", 'ř': "r", 'ś': "s", 'ŝ': "s",
+		'ş': "s", 'š': "s", 'ţ': "t", 'ť': "t", 'ŧ': "t", 'ũ': "u", 'ū': "u", 'ŭ': "u",
+		'ů': "u", 'ű': "u", 'ų': "u", 'ŵ': "w", 'ŷ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+		'ſ': "s", 'ș': "s", 'ț': "t",
+
+		// Cyrillic, using Russian romanisation for the shared letters
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+		'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+		'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+		'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+		'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j",
+		'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz", 'ѓ': "gj", 'ќ': "kj", 'ѕ': "dz",
+
+		// Greek, including letters with accents
+		'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+		'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+		'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+		'ω': "o", 'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+		'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+
+		// symbols, padded with spaces so they become words of their own in a slug
+		'€': " euro ", '£': " pound ", '¥': " yen ", '©': " c ", '®': " r ", '™': " tm ",
+		'°': " degrees ", '½': " half ", '¼': " quarter ", '×': " x ", '–': "-", '—': "-",
+		'‘': "", '’': "", '“': "", '”': "",
+	},
+)
+
+// transliterateASCII holds the ASCII symbols Slugify spells out rather than dropping
+var transliterateASCII = map[rune]string{
+	'&': " and ", '@': " at ", '%': " percent ", '$': " dollar ",
+}
+
+// slugLanguages holds the tables for SlugLanguage, keyed by ISO 639-1 code
+var slugLanguages = map[string]map[rune]string{
+	"de": withUpper(map[rune]string{'ä': "ae", 'ö': "oe", 'ü': "ue"}),
+	"da": withUpper(map[rune]string{'æ': "ae", 'ø': "oe", 'å': "aa"}),
+	"no": withUpper(map[rune]string{'æ': "ae", 'ø': "oe", 'å': "aa"}),
+	"nb": withUpper(map[rune]string{'æ': "ae", 'ø': "oe", 'å': "aa"}),
+	"uk": withUpper(map[rune]string{'г': "h", 'и': "y", 'х': "kh", 'щ': "shch", 'ь': ""}),
+	"bg": withUpper(map[rune]string{'щ': "sht", 'ъ': "a", 'ю': "yu", 'я': "ya"}),
+}
+
+// withUpper adds the upper case form of every letter in table, with its replacement capitalised
+func withUpper(table map[rune]string) map[rune]string {
+	upper := make(map[rune]string, len(table)*2)
+	for r, v := range table {
+		upper[r] = v
+
+		u := unicode.ToUpper(r)
+		if _, exists := table[u]; u == r || exists {
+			continue
+		}
+
+		if v != "" {
+			first, size := utf8.DecodeRuneInString(v)
+			v = string(unicode.ToUpper(first)) + v[size:]
+		}
+		upper[u] = v
+	}
+	return upper
+}
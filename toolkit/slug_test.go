@@ -0,0 +1,169 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+var transliterateTests = []struct {
+	name     string
+	language string
+	s        string
+	expected string
+}{
+	{name: "latin", s: "Crème Brûlée à la Ñandú", expected: "Creme Brulee a la Nandu"},
+	{name: "extended latin", s: "Łódź Škoda Ørsted ß", expected: "Lodz Skoda Orsted ss"},
+	{name: "upper case digraphs", s: "Жук Щука Þór", expected: "Zhuk Shchuka Thor"},
+	{name: "greek", s: "Ελληνικά", expected: "Ellinika"},
+	{name: "ascii symbols kept", s: "a & b", expected: "a & b"},
+	{name: "untranslatable kept", s: "日本", expected: "日本"},
+	{name: "german", language: "de", s: "Müller Größe", expected: "Mueller Groesse"},
+	{name: "german upper case", language: "DE", s: "Ärger", expected: "Aerger"},
+	{name: "danish", language: "da", s: "Smørrebrød på Ærø", expected: "Smoerrebroed paa Aeroe"},
+	{name: "ukrainian", language: "uk", s: "Київ Харків", expected: "Kyyiv Kharkiv"},
+	{name: "unknown language", language: "xx", s: "Müller", expected: "Muller"},
+}
+
+func TestTools_Transliterate(t *testing.T) {
+	for _, e := range transliterateTests {
+		tool := Tools{SlugLanguage: e.language}
+
+		if got := tool.Transliterate(e.s); got != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestTools_SlugifyLanguage(t *testing.T) {
+	tool := Tools{SlugLanguage: "de"}
+
+	slug, err := tool.Slugify("Über Straßen")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slug != "ueber-strassen" {
+		t.Errorf("wrong slug: %s", slug)
+	}
+}
+
+var slugOptionsTests = []struct {
+	name          string
+	s             string
+	opts          SlugOptions
+	expected      string
+	errorExpected bool
+	reserved      bool
+}{
+	{name: "defaults", s: "Now is the time", expected: "now-is-the-time"},
+	{name: "separator", s: "Now is the time", opts: SlugOptions{Separator: "_"}, expected: "now_is_the_time"},
+	{name: "max length on word boundary", s: "The quick brown fox jumps", opts: SlugOptions{MaxLength: 17}, expected: "the-quick-brown"},
+	{name: "max length exact", s: "The quick brown fox", opts: SlugOptions{MaxLength: 19}, expected: "the-quick-brown-fox"},
+	{name: "max length long first word", s: "Supercalifragilistic word", opts: SlugOptions{MaxLength: 10}, expected: "supercalif"},
+	{name: "max length with separator", s: "aa bb cc", opts: SlugOptions{Separator: "--", MaxLength: 7}, expected: "aa--bb"},
+	{name: "stop words", s: "The Lord of the Rings", opts: SlugOptions{StopWords: StopWordsEnglish}, expected: "lord-rings"},
+	{name: "only stop words", s: "To be or not to be", opts: SlugOptions{StopWords: []string{"to", "be", "or", "not"}}, expected: "to-be-or-not-to-be"},
+	{name: "preserve case", s: "Hello Wörld", opts: SlugOptions{PreserveCase: true}, expected: "Hello-World"},
+	{name: "preserve case stop words", s: "The Hobbit", opts: SlugOptions{PreserveCase: true, StopWords: StopWordsEnglish}, expected: "Hobbit"},
+	{name: "reserved", s: "Admin", opts: SlugOptions{ReservedWords: []string{"admin", "new"}}, errorExpected: true, reserved: true},
+	{name: "reserved after truncation", s: "New articles", opts: SlugOptions{MaxLength: 5, ReservedWords: []string{"new"}}, errorExpected: true, reserved: true},
+	{name: "not reserved", s: "New admin", opts: SlugOptions{ReservedWords: []string{"admin", "new"}}, expected: "new-admin"},
+	{name: "language", s: "Grüße", opts: SlugOptions{Language: "de"}, expected: "gruesse"},
+	{name: "empty", s: "", errorExpected: true},
+	{name: "nothing left", s: "!!!", errorExpected: true},
+}
+
+func TestTools_SlugifyWithOptions(t *testing.T) {
+	var tool Tools
+
+	for _, e := range slugOptionsTests {
+		slug, err := tool.SlugifyWithOptions(e.s, e.opts)
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if errors.Is(err, ErrReservedSlug) != e.reserved {
+			t.Errorf("%s: expected reserved error %v but got %v", e.name, e.reserved, err)
+		}
+
+		if slug != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, slug)
+		}
+	}
+}
+
+var uniqueSlugTests = []struct {
+	name          string
+	s             string
+	taken         []string
+	opts          UniqueSlugOptions
+	expected      string
+	pattern       string
+	expectedError error
+}{
+	{name: "free", s: "My Title", expected: "my-title"},
+	{name: "taken", s: "My Title", taken: []string{"my-title"}, expected: "my-title-2"},
+	{name: "counts up", s: "My Title", taken: []string{"my-title", "my-title-2", "my-title-3"}, expected: "my-title-4"},
+	{name: "separator", s: "My Title", taken: []string{"my_title"}, opts: UniqueSlugOptions{SlugOptions: SlugOptions{Separator: "_"}}, expected: "my_title_2"},
+	{name: "random suffix", s: "My Title", taken: []string{"my-title"}, opts: UniqueSlugOptions{RandomSuffix: true}, pattern: `^my-title-[a-z0-9]{6}$`},
+	{name: "random suffix length", s: "My Title", taken: []string{"my-title"}, opts: UniqueSlugOptions{RandomSuffix: true, SuffixLength: 3}, pattern: `^my-title-[a-z0-9]{3}$`},
+	{name: "max length leaves room", s: "The quick brown fox", taken: []string{"the-quick-brown"}, opts: UniqueSlugOptions{SlugOptions: SlugOptions{MaxLength: 15}}, expected: "the-quick-2"},
+	{name: "reserved", s: "New", opts: UniqueSlugOptions{SlugOptions: SlugOptions{ReservedWords: []string{"new"}}}, expected: "new-2"},
+	{name: "exhausted", s: "a", taken: []string{"a", "a-2", "a-3"}, opts: UniqueSlugOptions{MaxAttempts: 3}, expectedError: ErrSlugAttemptsExhausted},
+}
+
+func TestTools_UniqueSlug(t *testing.T) {
+	var tool Tools
+
+	for _, e := range uniqueSlugTests {
+		slug, err := tool.UniqueSlug(context.Background(), e.s, SlugSet(e.taken...), e.opts)
+
+		if e.expectedError == nil && err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected error %q but got %v", e.name, e.expectedError, err)
+		}
+
+		if e.pattern != "" {
+			if !regexp.MustCompile(e.pattern).MatchString(slug) {
+				t.Errorf("%s: %q doesn't match %s", e.name, slug, e.pattern)
+			}
+		} else if slug != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, slug)
+		}
+	}
+}
+
+func TestTools_UniqueSlugCallback(t *testing.T) {
+	var tool Tools
+
+	// the callback's error is returned
+	lookupErr := errors.New("database down")
+	_, err := tool.UniqueSlug(context.Background(), "title", func(ctx context.Context, slug string) (bool, error) {
+		return false, lookupErr
+	})
+	if !errors.Is(err, lookupErr) {
+		t.Errorf("expected the lookup error but got %v", err)
+	}
+
+	// the context is checked between attempts
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err = tool.UniqueSlug(ctx, "title", func(ctx context.Context, slug string) (bool, error) {
+		calls++
+		cancel()
+		return true, nil
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("expected to stop after the context was cancelled, got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,136 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// StaticFiles is an http.Handler serving files from Root. Unlike http.FileServer it never lists
+// directories, never serves dotfiles or anything in a dot directory, and can be limited to an allow
+// list of paths and extensions. Anything it won't serve gets a 404, so it doesn't reveal what exists
+type StaticFiles struct {
+	Root string
+	// AllowedPaths limits what is served to these URL paths, such as "/index.html". A path ending
+	// in "/" allows everything under it. Empty allows every path
+	AllowedPaths []string
+	// AllowedExtensions limits what is served to files with these extensions, such as ".css".
+	// Empty allows every extension
+	AllowedExtensions []string
+	// CacheControl is sent with every file, such as "public, max-age=3600". Empty sends nothing
+	CacheControl string
+	// Index is served for a request for a directory, "index.html" if empty
+	Index string
+}
+
+// ServeHTTP serves the file for r.URL.Path
+func (s *StaticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := path.Clean("/" + r.URL.Path)
+
+	f, info, err := s.open(urlPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	if s.CacheControl != "" {
+		w.Header().Set("Cache-Control", s.CacheControl)
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// open finds the file to serve for urlPath, which must be clean and absolute
+func (s *StaticFiles) open(urlPath string) (*os.File, os.FileInfo, error) {
+	for _, part := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(part, ".") {
+			return nil, nil, os.ErrNotExist
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(s.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if root, err = filepath.Abs(root); err != nil {
+		return nil, nil, err
+	}
+
+	name := filepath.Join(root, filepath.FromSlash(urlPath))
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		index := s.Index
+		if index == "" {
+			index = "index.html"
+		}
+
+		urlPath = path.Join(urlPath, index)
+		name = filepath.Join(name, index)
+	}
+
+	if !s.allowed(urlPath) {
+		return nil, nil, os.ErrNotExist
+	}
+
+	// symlinks inside Root can't be used to serve files from outside it
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resolved != root && !isWithin(root, resolved) {
+		return nil, nil, os.ErrNotExist
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err = f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = errors.New("not a regular file")
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, info, nil
+}
+
+// allowed checks urlPath against AllowedPaths and AllowedExtensions
+func (s *StaticFiles) allowed(urlPath string) bool {
+	if len(s.AllowedExtensions) > 0 && !containsFold(s.AllowedExtensions, path.Ext(urlPath)) {
+		return false
+	}
+
+	if len(s.AllowedPaths) == 0 {
+		return true
+	}
+
+	for _, p := range s.AllowedPaths {
+		if urlPath == p || strings.HasSuffix(p, "/") && strings.HasPrefix(urlPath, p) {
+			return true
+		}
+	}
+	return false
+}
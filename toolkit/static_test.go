@@ -0,0 +1,108 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var staticFilesTests = []struct {
+	name           string
+	method         string
+	path           string
+	handler        StaticFiles
+	expectedStatus int
+	expectedBody   string
+}{
+	{name: "file", path: "/style.css", expectedStatus: http.StatusOK, expectedBody: "css"},
+	{name: "index", path: "/", expectedStatus: http.StatusOK, expectedBody: "home"},
+	{name: "nested index", path: "/docs/", expectedStatus: http.StatusOK, expectedBody: "docs"},
+	{name: "index file directly", path: "/index.html", expectedStatus: http.StatusOK, expectedBody: "home"},
+	{name: "no listing", path: "/assets/", expectedStatus: http.StatusNotFound},
+	{name: "dotfile", path: "/.env", expectedStatus: http.StatusNotFound},
+	{name: "dot directory", path: "/.git/config", expectedStatus: http.StatusNotFound},
+	{name: "missing", path: "/missing.css", expectedStatus: http.StatusNotFound},
+	{name: "traversal", path: "/../secret.txt", expectedStatus: http.StatusNotFound},
+	{name: "symlink out of root", path: "/link/secret.txt", expectedStatus: http.StatusNotFound},
+	{name: "method not allowed", method: "POST", path: "/style.css", expectedStatus: http.StatusMethodNotAllowed},
+	{name: "head", method: "HEAD", path: "/style.css", expectedStatus: http.StatusOK},
+	{name: "allowed path", path: "/", handler: StaticFiles{AllowedPaths: []string{"/index.html"}}, expectedStatus: http.StatusOK, expectedBody: "home"},
+	{name: "not an allowed path", path: "/style.css", handler: StaticFiles{AllowedPaths: []string{"/index.html"}}, expectedStatus: http.StatusNotFound},
+	{name: "allowed directory", path: "/assets/app.js", handler: StaticFiles{AllowedPaths: []string{"/assets/"}}, expectedStatus: http.StatusOK, expectedBody: "js"},
+	{name: "allowed extension", path: "/assets/app.js", handler: StaticFiles{AllowedExtensions: []string{".JS"}}, expectedStatus: http.StatusOK, expectedBody: "js"},
+	{name: "not an allowed extension", path: "/main.go", handler: StaticFiles{AllowedExtensions: []string{".js", ".html"}}, expectedStatus: http.StatusNotFound},
+	{name: "custom index", path: "/docs/", handler: StaticFiles{Index: "readme.txt"}, expectedStatus: http.StatusOK, expectedBody: "readme"},
+}
+
+func TestStaticFiles(t *testing.T) {
+	root := t.TempDir()
+	site := filepath.Join(root, "site")
+
+	files := map[string]string{
+		"index.html":      "home",
+		"style.css":       "css",
+		"main.go":         "package main",
+		".env":            "SECRET=1",
+		".git/config":     "config",
+		"assets/app.js":   "js",
+		"docs/index.html": "docs",
+		"docs/readme.txt": "readme",
+	}
+	for name, content := range files {
+		_ = os.MkdirAll(filepath.Dir(filepath.Join(site, name)), 0755)
+		_ = os.WriteFile(filepath.Join(site, name), []byte(content), 0644)
+	}
+
+	_ = os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644)
+	_ = os.Symlink(root, filepath.Join(site, "link"))
+
+	for _, e := range staticFilesTests {
+		handler := e.handler
+		handler.Root = site
+		handler.CacheControl = "public, max-age=60"
+
+		method := e.method
+		if method == "" {
+			method = "GET"
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, e.path, nil))
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		body, _ := io.ReadAll(rr.Body)
+		if e.expectedBody != "" && string(body) != e.expectedBody {
+			t.Errorf("%s: expected body %q but got %q", e.name, e.expectedBody, body)
+		}
+
+		if rr.Code == http.StatusOK && (rr.Header().Get("Cache-Control") != "public, max-age=60" || rr.Header().Get("ETag") == "") {
+			t.Errorf("%s: cache headers not set: %v", e.name, rr.Header())
+		}
+	}
+}
+
+func TestStaticFiles_NotModified(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "index.html"), []byte("home"), 0644)
+
+	handler := &StaticFiles{Root: root}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 but got %d", rr.Code)
+	}
+}
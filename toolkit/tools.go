@@ -2,49 +2,162 @@ package toolkit
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-const randomStringSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVQXYZ0123456789_+"
+const randomStringSource = AlphabetURLSafe
+
+// Alphabets which can be used with RandomStringFrom, or set as the RandomStringAlphabet
+const (
+	// AlphabetURLSafe is letters, digits, '-' and '_', which need no escaping in URLs or file names
+	AlphabetURLSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-"
+	// AlphabetAlphanumeric is upper and lower case letters and digits
+	AlphabetAlphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// AlphabetHex is lower case hexadecimal digits
+	AlphabetHex = "0123456789abcdef"
+	// AlphabetHumanFriendly leaves out characters that are easily confused, such as 0/O and 1/l/I,
+	// for codes people have to read or type
+	AlphabetHumanFriendly = "23456789abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
 
 // Tools is the type used to instantiate this module. Any variable of this type will have access
 // to all the methods with the reciever *Tools
 type Tools struct {
+	RandomStringAlphabet string
+	UploadNameScheme     IDScheme
+	UploadQuota          *UploadQuota
+	UploadLayout         UploadLayout
+	UploadMetadata       MetadataStore
+	UploadUserID         func(r *http.Request) string
+
 	MaxFileSize        int
 	AllowedTypes       []string
 	MaxJsonSize        int
+	MaxJsonStreamSize  int
 	AllowUnknownFields bool
+	CompressRemoteJSON bool
+	CompressMinSize    int
+	CompressibleTypes  []string
+
+	JSONIndent            string
+	JSONPrettyParam       string
+	JSONDisableHTMLEscape bool
+	JSONEnvelope          string
+
+	RemoteRetry           *RetryPolicy
+	MaxRemoteResponseSize int
+	CircuitBreaker        *CircuitBreaker
+	RateLimiter           *RateLimiter
+
+	SlugLanguage string
+
+	WebhookSignatureHeader string
+	WebhookTolerance       time.Duration
 }
 
-// RandomString returns a string of random characters of length n using randomStringSource
-// as the source for the string
+// RandomString returns a string of random characters of length n using RandomStringAlphabet, or
+// randomStringSource if it isn't set, as the source for the string. It panics if the alphabet is
+// invalid or the system's source of randomness fails, use RandomStringFrom to handle those as errors
 func (t *Tools) RandomString(n int) string {
-	s, r := make([]rune, n), []rune(randomStringSource)
+	s, err := t.RandomStringFrom(n, t.randomStringAlphabet())
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+func (t *Tools) randomStringAlphabet() string {
+	if t.RandomStringAlphabet != "" {
+		return t.RandomStringAlphabet
+	}
+	return randomStringSource
+}
+
+// RandomStringFrom returns a string of n characters chosen uniformly from alphabet. Random values that
+// would favour some characters over others are thrown away rather than wrapped with a modulo
+func (t *Tools) RandomStringFrom(n int, alphabet string) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("length must not be negative, got %d", n)
+	}
+
+	r := []rune(alphabet)
+	if len(r) < 2 || len(r) > 1<<16 {
+		return "", errors.New("alphabet must contain between 2 and 65536 characters")
+	}
 
-	for i := range s {
-		p, _ := rand.Prime(rand.Reader, len(r))
-		x, y := p.Uint64(), uint64(len(r))
-		s[i] = r[x%y]
+	seen := make(map[rune]bool, len(r))
+	for _, c := range r {
+		if seen[c] {
+			return "", fmt.Errorf("alphabet contains %q more than once", c)
+		}
+		seen[c] = true
+	}
+
+	// each sample uses the fewest bits that can index the whole alphabet, and is rejected if it
+	// falls past the end
+	bits := 1
+	for 1<<bits < len(r) {
+		bits++
+	}
+	mask := uint32(1<<bits - 1)
+
+	width := 1
+	if bits > 8 {
+		width = 2
 	}
 
-	return string(s)
+	s := make([]rune, 0, n)
+	buf := make([]byte, (n+n/2+8)*width)
+	for len(s) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("unable to read random data: %w", err)
+		}
+
+		for i := 0; i+width <= len(buf) && len(s) < n; i += width {
+			x := uint32(buf[i])
+			if width == 2 {
+				x = x<<8 | uint32(buf[i+1])
+			}
+
+			if x &= mask; int(x) < len(r) {
+				s = append(s, r[x])
+			}
+		}
+	}
+
+	return string(s), nil
 }
 
+// Errors returned by UploadFiles when an upload is refused. Anything else it returns is a failure
+// to store the files rather than a problem with the request
+var (
+	ErrFileTooBig         = errors.New("the uploaded file is too big")
+	ErrFileTypeNotAllowed = errors.New("the uploaded file type is not permitted")
+	ErrNoFile             = errors.New("no file was uploaded")
+	ErrInvalidUpload      = errors.New("unable to read the upload")
+)
+
 // UploadedFile is a struct used to save information about an uploaded file
 type UploadedFile struct {
 	NewFileName      string
 	OriginalFileName string
 	FileSize         int64
+	RelativePath     string
+	ContentType      string
 }
 
 func (t *Tools) UploadOneFIle(r *http.Request, uploadDir string, rename ...bool) (*UploadedFile, error) {
@@ -58,6 +171,10 @@ func (t *Tools) UploadOneFIle(r *http.Request, uploadDir string, rename ...bool)
 		return nil, err
 	}
 
+	if len(files) == 0 {
+		return nil, ErrNoFile
+	}
+
 	return files[0], nil
 
 }
@@ -81,13 +198,36 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 
 	err = r.ParseMultipartForm(int64(t.MaxFileSize))
 	if err != nil {
-		return nil, errors.New("the uploaded file is too big")
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, ErrFileTooBig
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidUpload, err)
+	}
+
+	if len(r.MultipartForm.File) == 0 {
+		return nil, ErrNoFile
 	}
 
+	quota, err := t.newQuotaUsage(r, uploadDir)
+	if err != nil {
+		return nil, err
+	}
+	defer quota.release()
+
 	for _, fHeaders := range r.MultipartForm.File {
 		for _, hdr := range fHeaders {
 			uploadedFiles, err = func(uploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
 				var uploadedFile UploadedFile
+
+				if hdr.Size > int64(t.MaxFileSize) {
+					return nil, ErrFileTooBig
+				}
+
+				if err := quota.reserve(hdr.Size); err != nil {
+					return nil, err
+				}
+
 				infile, err := hdr.Open()
 				if err != nil {
 					return nil, err
@@ -95,14 +235,14 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 				defer infile.Close()
 
 				buff := make([]byte, 512)
-				_, err = infile.Read(buff)
-				if err != nil {
+				n, err := infile.Read(buff)
+				if err != nil && err != io.EOF {
 					return nil, err
 				}
 
 				// TODO: check to see if the file type is permitted
 				allowed := false
-				fileType := http.DetectContentType(buff)
+				fileType := http.DetectContentType(buff[:n])
 
 				if len(t.AllowedTypes) > 0 {
 					for _, x := range t.AllowedTypes {
@@ -115,7 +255,7 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 				}
 
 				if !allowed {
-					return nil, errors.New("the uploaded filed type is not permitted")
+					return nil, ErrFileTypeNotAllowed
 				}
 
 				_, err = infile.Seek(0, 0)
@@ -124,20 +264,39 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 				}
 
 				uploadedFile.OriginalFileName = hdr.Filename
+				uploadedFile.ContentType = fileType
 
 				if renameFile {
-					uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
+					name, err := t.NewID(t.UploadNameScheme)
+					if err != nil {
+						return nil, err
+					}
+					uploadedFile.NewFileName = fmt.Sprintf("%s%s", name, filepath.Ext(hdr.Filename))
 				} else {
-					uploadedFile.NewFileName = hdr.Filename
+					uploadedFile.NewFileName = filepath.Base(hdr.Filename)
+					if err := checkFileName(uploadedFile.NewFileName); err != nil {
+						return nil, err
+					}
+				}
+
+				uploadedFile.RelativePath = uploadedFile.NewFileName
+				if t.UploadLayout != nil {
+					dir := t.UploadLayout.Dir(uploadedFile.NewFileName, time.Now())
+					if err := t.CreateDirIfNotExists(filepath.Join(uploadDir, dir)); err != nil {
+						return nil, err
+					}
+					uploadedFile.RelativePath = filepath.ToSlash(filepath.Join(dir, uploadedFile.NewFileName))
 				}
 
 				var outfile *os.File
 				defer outfile.Close()
 
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadedFile.NewFileName)); err != nil {
+				hash := sha256.New()
+
+				if outfile, err = os.Create(filepath.Join(uploadDir, filepath.FromSlash(uploadedFile.RelativePath))); err != nil {
 					return nil, err
 				} else {
-					fileSize, err := io.Copy(outfile, infile)
+					fileSize, err := io.Copy(io.MultiWriter(outfile, hash), infile)
 					if err != nil {
 						return nil, err
 					}
@@ -145,6 +304,26 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 					uploadedFile.FileSize = fileSize
 				}
 
+				if t.UploadMetadata != nil {
+					meta := &FileMetadata{
+						NewFileName:      uploadedFile.NewFileName,
+						OriginalFileName: uploadedFile.OriginalFileName,
+						RelativePath:     uploadedFile.RelativePath,
+						FileSize:         uploadedFile.FileSize,
+						ContentType:      uploadedFile.ContentType,
+						UploadedAt:       time.Now(),
+						SHA256:           hex.EncodeToString(hash.Sum(nil)),
+					}
+
+					if t.UploadUserID != nil {
+						meta.UploaderID = t.UploadUserID(r)
+					}
+
+					if err := t.UploadMetadata.Put(meta); err != nil {
+						return nil, err
+					}
+				}
+
 				uploadedFiles = append(uploadedFiles, &uploadedFile)
 
 				return uploadedFiles, nil
@@ -157,41 +336,83 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 	return uploadedFiles, nil
 }
 
-// CreateDirIfNotExists creates directory and all necessary parents if they don't exists
+// CreateDirIfNotExists creates directory and all necessary parents if they don't exists. It returns
+// ErrNotDirectory if a file is in the way, see CreateDir to choose the mode and owner
 func (t *Tools) CreateDirIfNotExists(dir string) error {
-	const mode = 0755
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		err := os.MkdirAll(dir, mode)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return t.CreateDir(dir)
 }
 
-// Slugify is a simple means of creating a slug from as tring
+// Slugify is a simple means of creating a slug from as tring. Accented letters, Cyrillic, Greek and
+// some symbols are transliterated first, see Transliterate. Use SlugifyWithOptions for more control
 func (t *Tools) Slugify(s string) (string, error) {
-	if s == "" {
-		return "", errors.New("empty string not permitted")
-	}
-
-	re := regexp.MustCompile(`[^a-z\d]+`)
-	slug := strings.Trim(re.ReplaceAllString(strings.ToLower(s), "-"), "-")
-	if len(slug) == 0 {
-		return "", errors.New("after removing characters slug is 0 length")
-	}
-	return slug, nil
+	return t.SlugifyWithOptions(s, SlugOptions{})
 }
 
 // DownloadStaticFile downloads the file and attempt to force the browser to avoid displaying it
-// in the browser window by setting content disposition. It also allows specification of the display name
+// in the browser window by setting content disposition. It also allows specification of the display name.
+// file can be an UploadedFile's RelativePath, or its NewFileName when UploadLayout can find it, and
+// can't refer to anything outside p. If displayName is empty the original name from UploadMetadata is
+// used, or the stored name if there is no metadata
 func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, p, file, displayName string) {
-	fp := path.Join(p, file)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
+	fp, err := t.resolveUpload(p, file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if displayName == "" {
+		displayName = filepath.Base(fp)
+		if t.UploadMetadata != nil {
+			if meta, err := t.UploadMetadata.Get(filepath.Base(fp)); err == nil && meta.OriginalFileName != "" {
+				displayName = meta.OriginalFileName
+			}
+		}
+	}
+
+	w.Header().Set("Content-Disposition", contentDisposition(displayName))
 
 	http.ServeFile(w, r, fp)
 }
 
+// contentDisposition returns an attachment Content-Disposition for name. Quotes and backslashes are
+// escaped so name can't add parameters of its own, control characters are dropped, and a name which
+// isn't plain ASCII gets an RFC 5987 filename* with an ASCII fallback for older clients
+func contentDisposition(name string) string {
+	var fallback, encoded strings.Builder
+	ascii := true
+
+	for _, c := range name {
+		switch {
+		case c < 0x20 || c == 0x7f:
+			continue
+		case c >= utf8.RuneSelf:
+			ascii = false
+			fallback.WriteByte('_')
+		case c == '"' || c == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(c)
+		default:
+			fallback.WriteRune(c)
+		}
+
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.ContainsRune("!#$&+-.^_`|~", c) {
+			encoded.WriteRune(c)
+			continue
+		}
+
+		var buf [utf8.UTFMax]byte
+		for _, b := range buf[:utf8.EncodeRune(buf[:], c)] {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	if ascii {
+		return fmt.Sprintf("attachment; filename=\"%s\"", fallback.String())
+	}
+
+	return fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", fallback.String(), encoded.String())
+}
+
 // JSONResponse is the type used for sending json around
 type JSONResponse struct {
 	Error   bool        `json:"error"`
@@ -199,14 +420,17 @@ type JSONResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-// ReadJSON tries to read the body of the request and convert it from jasonto go data variable
+// ReadJSON tries to read the body of the request and convert it from jasonto go data variable.
+// Bodies sent with a gzip or deflate Content-Encoding are decompressed before being decoded
 func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	maxBytes := 1024 * 1024
 	if t.MaxJsonSize != 0 {
 		maxBytes = t.MaxJsonSize
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	if err := decodedRequestBody(w, r, maxBytes); err != nil {
+		return err
+	}
 
 	dec := json.NewDecoder(r.Body)
 	if !t.AllowUnknownFields {
@@ -215,32 +439,7 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 
 	err := dec.Decode(data)
 	if err != nil {
-		syntaxError := &json.SyntaxError{}
-		unmarshallTypeError := &json.UnmarshalTypeError{}
-		invalidUnmarshallError := &json.InvalidUnmarshalError{}
-
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
-		case errors.As(err, &unmarshallTypeError):
-			if unmarshallTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshallTypeError.Field)
-			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshallTypeError.Offset)
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
-		case strings.HasPrefix(err.Error(), "json: unknown field"):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
-			return fmt.Errorf("body contained unknown key %s", fieldName)
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
-		case errors.As(err, &invalidUnmarshallError):
-			return fmt.Errorf("error umnarshalling JSON: %s", err.Error())
-		default:
-			return err
-		}
+		return jsonDecodeError(err, maxBytes)
 	}
 
 	err = dec.Decode(&struct{}{})
@@ -251,13 +450,101 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 	return nil
 }
 
-// WriteJSON takes a response status code and arbitrary data and writes json to the client
+// jsonDecodeError converts the errors returned by the json decoder into messages that are safe to
+// send back to the client
+func jsonDecodeError(err error, maxBytes int) error {
+	syntaxError := &json.SyntaxError{}
+	unmarshallTypeError := &json.UnmarshalTypeError{}
+	invalidUnmarshallError := &json.InvalidUnmarshalError{}
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("body contains badly-formed JSON")
+	case errors.As(err, &unmarshallTypeError):
+		if unmarshallTypeError.Field != "" {
+			return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshallTypeError.Field)
+		}
+		return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshallTypeError.Offset)
+	case errors.Is(err, io.EOF):
+		return errors.New("body must not be empty")
+	case strings.HasPrefix(err.Error(), "json: unknown field"):
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
+		return fmt.Errorf("body contained unknown key %s", fieldName)
+	case err.Error() == "http: request body too large":
+		return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+	case errors.As(err, &invalidUnmarshallError):
+		return fmt.Errorf("error umnarshalling JSON: %s", err.Error())
+	default:
+		return err
+	}
+}
+
+// WriteJSON takes a response status code and arbitrary data and writes json to the client.
+// Output is indented when JSONIndent is set and data is wrapped in a JSONEnvelope key if one is set
 func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
-	out, err := json.Marshal(data)
+	return t.writeJSON(w, status, t.envelope(data), t.JSONIndent, headers...)
+}
+
+// WriteJSONForRequest works like WriteJSON, but also pretty prints the output when the request has
+// the JSONPrettyParam query parameter set, e.g. ?pretty or ?pretty=true
+func (t *Tools) WriteJSONForRequest(w http.ResponseWriter, r *http.Request, status int, data interface{}, headers ...http.Header) error {
+	indent := t.JSONIndent
+	if indent == "" && t.wantsPrettyJSON(r) {
+		indent = "\t"
+	}
+
+	return t.writeJSON(w, status, t.envelope(data), indent, headers...)
+}
+
+// wantsPrettyJSON reports whether the request asked for indented output
+func (t *Tools) wantsPrettyJSON(r *http.Request) bool {
+	if t.JSONPrettyParam == "" {
+		return false
+	}
+
+	q := r.URL.Query()
+	if !q.Has(t.JSONPrettyParam) {
+		return false
+	}
+
+	switch strings.ToLower(q.Get(t.JSONPrettyParam)) {
+	case "0", "false", "no":
+		return false
+	}
+	return true
+}
+
+// envelope wraps data in the JSONEnvelope key, if there is one
+func (t *Tools) envelope(data interface{}) interface{} {
+	if t.JSONEnvelope == "" {
+		return data
+	}
+	return map[string]interface{}{t.JSONEnvelope: data}
+}
+
+func (t *Tools) writeJSON(w http.ResponseWriter, status int, data interface{}, indent string, headers ...http.Header) error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(!t.JSONDisableHTMLEscape)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+
+	err := enc.Encode(data)
 	if err != nil {
 		return err
 	}
 
+	// the encoder always ends with a newline, which json.Marshal never did, so only keep it when
+	// the output is meant for people to read
+	out := buf.Bytes()
+	if indent == "" {
+		out = bytes.TrimSuffix(out, []byte("\n"))
+	}
+
 	if len(headers) > 0 {
 		for key, value := range headers[0] {
 			w.Header()[key] = value
@@ -275,7 +562,8 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 	return nil
 }
 
-// ErrorJSON takes an error and optionally a status code, then generates and sends a JSON error message
+// ErrorJSON takes an error and optionally a status code, then generates and sends a JSON error message.
+// Error messages are never wrapped in the JSONEnvelope
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
 	statusCode := http.StatusBadRequest
 
@@ -288,31 +576,24 @@ func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error
 		Message: err.Error(),
 	}
 
-	return t.WriteJSON(w, statusCode, payload)
+	return t.writeJSON(w, statusCode, payload, t.JSONIndent)
 }
 
 // PushJSONToRemote pushes some arbitrary date to some URL as json and turnes the response, status code and error
-// The final parameter client is optional, if none is specified we use the standard http.client
+// The final parameter client is optional, if none is specified we use the standard http.client.
+// The response body has already been closed, use CallRemote for anything that needs to read it
 func (t *Tools) PushJSONToRemote(uri string, data interface{}, client ...*http.Client) (*http.Response, int, error) {
-
-	payload, err := json.Marshal(data)
-	if err != nil {
-		return nil, 0, err
+	request := RemoteRequest{
+		Method: "POST",
+		URL:    uri,
+		Data:   data,
 	}
 
-	httpClient := &http.Client{}
 	if len(client) > 0 {
-		httpClient = client[0]
-	}
-
-	request, err := http.NewRequest("POST", uri, bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, 0, err
+		request.Client = client[0]
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-
-	response, err := httpClient.Do(request)
+	response, err := t.CallRemote(context.Background(), request)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -26,6 +27,97 @@ func TestTools_RandomString(t *testing.T) {
 	}
 }
 
+var randomStringTests = []struct {
+	name          string
+	alphabet      string
+	length        int
+	errorExpected bool
+}{
+	{name: "url safe", alphabet: AlphabetURLSafe},
+	{name: "alphanumeric", alphabet: AlphabetAlphanumeric},
+	{name: "hex", alphabet: AlphabetHex},
+	{name: "human friendly", alphabet: AlphabetHumanFriendly},
+	{name: "custom unicode", alphabet: "αβγδε"},
+	{name: "large alphabet", alphabet: string(func() []rune {
+		r := make([]rune, 300)
+		for i := range r {
+			r[i] = rune(0x4e00 + i)
+		}
+		return r
+	}())},
+	{name: "single character", alphabet: "a", errorExpected: true},
+	{name: "duplicate character", alphabet: "abca", errorExpected: true},
+	{name: "negative length", alphabet: AlphabetURLSafe, length: -1, errorExpected: true},
+}
+
+func TestTools_RandomStringFrom(t *testing.T) {
+	testTools := &Tools{}
+
+	for _, e := range randomStringTests {
+		n := 50
+		if e.length != 0 {
+			n = e.length
+		}
+
+		s, err := testTools.RandomStringFrom(n, e.alphabet)
+
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected, but none received", e.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+			continue
+		}
+
+		if len([]rune(s)) != 50 {
+			t.Errorf("%s: wrong length random string returned: %d", e.name, len([]rune(s)))
+		}
+
+		for _, c := range s {
+			if !strings.ContainsRune(e.alphabet, c) {
+				t.Errorf("%s: %q is not in the alphabet", e.name, c)
+			}
+		}
+	}
+}
+
+func TestTools_RandomStringIsUniform(t *testing.T) {
+	testTools := &Tools{}
+
+	// 10 characters doesn't divide evenly into a byte, so a modulo would favour the first few
+	alphabet := "0123456789"
+	s, err := testTools.RandomStringFrom(100000, alphabet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[rune]int{}
+	for _, c := range s {
+		counts[c]++
+	}
+
+	for _, c := range alphabet {
+		if counts[c] < 9000 || counts[c] > 11000 {
+			t.Errorf("%q appeared %d times, expected about 10000", c, counts[c])
+		}
+	}
+}
+
+func TestTools_RandomStringAlphabet(t *testing.T) {
+	testTools := &Tools{RandomStringAlphabet: AlphabetHex}
+
+	s := testTools.RandomString(20)
+	for _, c := range s {
+		if !strings.ContainsRune(AlphabetHex, c) {
+			t.Errorf("%q is not a hex digit", c)
+		}
+	}
+}
+
 var uploadTests = []struct {
 	name          string
 	allowedTypes  []string
@@ -162,6 +254,48 @@ func TestTools_UploadOneFile(t *testing.T) {
 
 }
 
+var uploadErrorTests = []struct {
+	name          string
+	tool          Tools
+	files         map[string]string
+	contentType   string
+	bodyLimit     int64
+	expectedError error
+}{
+	{name: "file too big", tool: Tools{MaxFileSize: 3}, expectedError: ErrFileTooBig},
+	{name: "body too big", bodyLimit: 10, expectedError: ErrFileTooBig},
+	{name: "type not allowed", tool: Tools{AllowedTypes: []string{"image/png"}}, expectedError: ErrFileTypeNotAllowed},
+	{name: "no file", files: map[string]string{}, expectedError: ErrNoFile},
+	{name: "not multipart", contentType: "application/json", expectedError: ErrInvalidUpload},
+}
+
+func TestTools_UploadFilesErrors(t *testing.T) {
+	for _, e := range uploadErrorTests {
+		files := e.files
+		if files == nil {
+			files = map[string]string{"a.txt": "hello"}
+		}
+
+		req := newUploadRequest(t, files)
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+		if e.bodyLimit > 0 {
+			req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, e.bodyLimit)
+		}
+
+		_, err := e.tool.UploadFiles(req, t.TempDir())
+		if !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected error %q but got %v", e.name, e.expectedError, err)
+		}
+	}
+
+	var tool Tools
+	if _, err := tool.UploadOneFIle(newUploadRequest(t, map[string]string{}), t.TempDir()); !errors.Is(err, ErrNoFile) {
+		t.Errorf("expected ErrNoFile uploading one file with none sent but got %v", err)
+	}
+}
+
 func TestTools_CreateDirIfNotExist(t *testing.T) {
 	path := "test/path/check"
 	tool := Tools{}
@@ -184,8 +318,12 @@ var slugTests = []struct {
 }{
 	{name: "valid string", s: "now is the time", expected: "now-is-the-time", errorExpected: false},
 	{name: "empty string", s: "", expected: "", errorExpected: true},
-	{name: "complex string", s: "Now is the time for all GOOD men! + fish & such &^123", expected: "now-is-the-time-for-all-good-men-fish-such-123", errorExpected: false},
+	{name: "complex string", s: "Now is the time for all GOOD men! + fish & such &^123", expected: "now-is-the-time-for-all-good-men-fish-and-such-and-123", errorExpected: false},
 	{name: "japanese string", s: "こんにちは", expected: "", errorExpected: true},
+	{name: "diacritics", s: "Crème Brûlée", expected: "creme-brulee", errorExpected: false},
+	{name: "cyrillic string", s: "Привет, мир", expected: "privet-mir", errorExpected: false},
+	{name: "greek string", s: "Καλημέρα κόσμε", expected: "kalimera-kosme", errorExpected: false},
+	{name: "symbols", s: "Rock & Roll @ 100% for €5", expected: "rock-and-roll-at-100-percent-for-euro-5", errorExpected: false},
 }
 
 func TestTools_Slugify(t *testing.T) {
@@ -301,6 +439,49 @@ func TestTools_WriteJSON(t *testing.T) {
 	}
 }
 
+var writeJSONTests = []struct {
+	name     string
+	tools    Tools
+	url      string
+	data     interface{}
+	expected string
+}{
+	{name: "defaults", url: "/", data: map[string]string{"foo": "<b>"}, expected: `{"foo":"\u003cb\u003e"}`},
+	{name: "no html escape", tools: Tools{JSONDisableHTMLEscape: true}, url: "/", data: map[string]string{"foo": "<b>"}, expected: `{"foo":"<b>"}`},
+	{name: "indent", tools: Tools{JSONIndent: "  "}, url: "/", data: map[string]int{"foo": 1}, expected: "{\n  \"foo\": 1\n}\n"},
+	{name: "envelope", tools: Tools{JSONEnvelope: "movie"}, url: "/", data: map[string]int{"foo": 1}, expected: `{"movie":{"foo":1}}`},
+	{name: "pretty param", tools: Tools{JSONPrettyParam: "pretty"}, url: "/?pretty", data: map[string]int{"foo": 1}, expected: "{\n\t\"foo\": 1\n}\n"},
+	{name: "pretty param false", tools: Tools{JSONPrettyParam: "pretty"}, url: "/?pretty=false", data: map[string]int{"foo": 1}, expected: `{"foo":1}`},
+	{name: "pretty param not enabled", url: "/?pretty", data: map[string]int{"foo": 1}, expected: `{"foo":1}`},
+}
+
+func TestTools_WriteJSONForRequest(t *testing.T) {
+	for _, e := range writeJSONTests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", e.url, nil)
+
+		err := e.tools.WriteJSONForRequest(rr, req, http.StatusOK, e.data)
+		if err != nil {
+			t.Errorf("%s: failed to write JSON: %v", e.name, err)
+		}
+
+		if rr.Body.String() != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_ErrorJSONIgnoresEnvelope(t *testing.T) {
+	tool := &Tools{JSONEnvelope: "data"}
+	rr := httptest.NewRecorder()
+
+	_ = tool.ErrorJSON(rr, errors.New("some error"))
+
+	if rr.Body.String() != `{"error":true,"message":"some error"}` {
+		t.Errorf("wrong error payload: %s", rr.Body.String())
+	}
+}
+
 func TestTools_ErrorJSON(t *testing.T) {
 	tool := &Tools{}
 	rr := httptest.NewRecorder()
@@ -0,0 +1,477 @@
+// Package tooltest provides fakes for testing code which calls remote servers with the toolkit,
+// without needing a real server. Transport is a programmable fake, and Recorder records real
+// interactions to a golden file and replays them later
+package tooltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// RecordedRequest is a copy of a request sent through a Transport, kept for assertions
+type RecordedRequest struct {
+	Method string
+	URL    string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// JSON decodes the body of the recorded request into v
+func (r RecordedRequest) JSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Expectation is a request the Transport expects to receive and the response it sends back
+type Expectation struct {
+	method  string
+	path    string
+	query   map[string]string
+	headers map[string]string
+	body    *string
+	json    interface{}
+
+	status          int
+	responseBody    []byte
+	responseHeaders http.Header
+	err             error
+
+	times int
+	calls int
+}
+
+// WithBody only matches requests whose body is exactly body
+func (e *Expectation) WithBody(body string) *Expectation {
+	e.body = &body
+	return e
+}
+
+// WithJSONBody only matches requests whose body decodes to the same JSON as v, ignoring formatting
+// and the order of keys
+func (e *Expectation) WithJSONBody(v interface{}) *Expectation {
+	e.json = normalizeJSON(v)
+	return e
+}
+
+// WithHeader only matches requests with the header set to value
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.headers[http.CanonicalHeaderKey(key)] = value
+	return e
+}
+
+// WithQuery only matches requests with the query parameter set to value
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	e.query[key] = value
+	return e
+}
+
+// Respond sets the status and body sent back for a matching request
+func (e *Expectation) Respond(status int, body string) *Expectation {
+	e.status = status
+	e.responseBody = []byte(body)
+	return e
+}
+
+// RespondJSON sets the status and sends v back as JSON for a matching request
+func (e *Expectation) RespondJSON(status int, v interface{}) *Expectation {
+	out, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("tooltest: can't marshal response: %s", err))
+	}
+
+	e.status = status
+	e.responseBody = out
+	e.responseHeaders.Set("Content-Type", "application/json")
+	return e
+}
+
+// RespondHeader adds a header to the response sent back for a matching request
+func (e *Expectation) RespondHeader(key, value string) *Expectation {
+	e.responseHeaders.Add(key, value)
+	return e
+}
+
+// RespondError makes a matching request fail with err, as if the network had failed
+func (e *Expectation) RespondError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times sets how many requests the expectation matches. 0 matches any number. Defaults to 1
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) matches(r *http.Request, body []byte) bool {
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+
+	if !strings.EqualFold(e.method, r.Method) || e.path != r.URL.Path {
+		return false
+	}
+
+	for key, value := range e.query {
+		if r.URL.Query().Get(key) != value {
+			return false
+		}
+	}
+
+	for key, value := range e.headers {
+		if r.Header.Get(key) != value {
+			return false
+		}
+	}
+
+	if e.body != nil && *e.body != string(body) {
+		return false
+	}
+
+	if e.json != nil {
+		var got interface{}
+		if err := json.Unmarshal(body, &got); err != nil || !reflect.DeepEqual(got, e.json) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *Expectation) String() string {
+	return fmt.Sprintf("%s %s", strings.ToUpper(e.method), e.path)
+}
+
+// Transport is a fake http.RoundTripper. Requests are matched against the expectations in the
+// order they were added, and anything that doesn't match gets a 501 Not Implemented response
+type Transport struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	requests     []RecordedRequest
+	unmatched    []RecordedRequest
+}
+
+// NewTransport returns a Transport with no expectations
+func NewTransport() *Transport {
+	return &Transport{}
+}
+
+// Client returns an http.Client which sends every request through the transport
+func (tr *Transport) Client() *http.Client {
+	return &http.Client{Transport: tr}
+}
+
+// Expect adds an expectation for a request with the given method and path, which responds with
+// 200 OK and an empty body unless told otherwise
+func (tr *Transport) Expect(method, path string) *Expectation {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	e := &Expectation{
+		method:          method,
+		path:            path,
+		query:           make(map[string]string),
+		headers:         make(map[string]string),
+		status:          http.StatusOK,
+		responseHeaders: make(http.Header),
+		times:           1,
+	}
+	tr.expectations = append(tr.expectations, e)
+	return e
+}
+
+// RoundTrip implements http.RoundTripper
+func (tr *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorded, err := record(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.requests = append(tr.requests, recorded)
+
+	for _, e := range tr.expectations {
+		if !e.matches(r, recorded.Body) {
+			continue
+		}
+
+		e.calls++
+		if e.err != nil {
+			return nil, e.err
+		}
+		return newResponse(r, e.status, e.responseHeaders.Clone(), e.responseBody), nil
+	}
+
+	tr.unmatched = append(tr.unmatched, recorded)
+	return newResponse(r, http.StatusNotImplemented, make(http.Header), []byte("tooltest: no expectation matched "+r.Method+" "+r.URL.Path)), nil
+}
+
+// Requests returns every request sent through the transport, in order
+func (tr *Transport) Requests() []RecordedRequest {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return append([]RecordedRequest(nil), tr.requests...)
+}
+
+// AssertExpectations fails the test if any expectation was not met, or any request didn't match one
+func (tr *Transport) AssertExpectations(t testing.TB) {
+	t.Helper()
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	for _, e := range tr.expectations {
+		if e.times > 0 && e.calls != e.times {
+			t.Errorf("tooltest: expected %s to be called %d times but it was called %d times", e, e.times, e.calls)
+		}
+	}
+
+	for _, r := range tr.unmatched {
+		t.Errorf("tooltest: unexpected request %s %s", r.Method, r.URL)
+	}
+}
+
+// record copies a request, putting the body back so it can still be read
+func record(r *http.Request) (RecordedRequest, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return RecordedRequest{}, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return RecordedRequest{
+		Method: r.Method,
+		URL:    r.URL.String(),
+		Path:   r.URL.Path,
+		Header: r.Header.Clone(),
+		Body:   body,
+	}, nil
+}
+
+func newResponse(r *http.Request, status int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+// normalizeJSON round trips v through JSON so it can be compared with a decoded request body
+func normalizeJSON(v interface{}) interface{} {
+	var raw []byte
+	switch x := v.(type) {
+	case string:
+		raw = []byte(x)
+	case []byte:
+		raw = x
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			panic(fmt.Sprintf("tooltest: can't marshal expected body: %s", err))
+		}
+	}
+
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		panic(fmt.Sprintf("tooltest: expected body is not valid JSON: %s", err))
+	}
+	return out
+}
+
+// Mode decides whether a Recorder talks to the real server or replays a golden file
+type Mode int
+
+const (
+	// ModeReplay answers requests from the golden file without touching the network
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the real server and saves the interactions to the golden file
+	ModeRecord
+)
+
+// Body is a request or response body saved in a golden file. Text is saved as a plain JSON string so
+// golden files stay readable, anything else, such as gzipped or image data, as {"base64": "..."}
+type Body []byte
+
+// MarshalJSON implements json.Marshaler
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(struct {
+		Base64 []byte `json:"base64"`
+	}{b})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = Body(text)
+		return nil
+	}
+
+	var encoded struct {
+		Base64 []byte `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	*b = encoded.Base64
+	return nil
+}
+
+// Interaction is a single request and response saved in a golden file
+type Interaction struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+		Body   Body   `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status int         `json:"status"`
+		Header http.Header `json:"header,omitempty"`
+		Body   Body        `json:"body,omitempty"`
+	} `json:"response"`
+
+	used bool
+}
+
+// ErrNoInteraction is returned by a replaying Recorder when a request isn't in the golden file
+var ErrNoInteraction = errors.New("tooltest: no recorded interaction matches the request")
+
+// Recorder is an http.RoundTripper which records real interactions to a golden file, or replays
+// them from it. Replayed requests are matched on method, URL and body
+type Recorder struct {
+	// Transport makes the real requests when recording. Defaults to http.DefaultTransport
+	Transport  http.RoundTripper
+	GoldenFile string
+	Mode       Mode
+
+	mu           sync.Mutex
+	interactions []*Interaction
+}
+
+// NewRecorder returns a Recorder for goldenFile. In replay mode the file is loaded straight away
+func NewRecorder(goldenFile string, mode Mode) (*Recorder, error) {
+	r := &Recorder{GoldenFile: goldenFile, Mode: mode}
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(goldenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("tooltest: golden file %s is corrupt: %w", goldenFile, err)
+	}
+
+	return r, nil
+}
+
+// Client returns an http.Client which sends every request through the recorder
+func (rec *Recorder) Client() *http.Client {
+	return &http.Client{Transport: rec}
+}
+
+// RoundTrip implements http.RoundTripper
+func (rec *Recorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorded, err := record(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec.Mode == ModeRecord {
+		return rec.recordInteraction(r, recorded)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	for _, i := range rec.interactions {
+		if i.used || i.Request.Method != r.Method || i.Request.URL != recorded.URL || !bytes.Equal(i.Request.Body, recorded.Body) {
+			continue
+		}
+
+		i.used = true
+		return newResponse(r, i.Response.Status, i.Response.Header.Clone(), i.Response.Body), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, r.Method, recorded.URL)
+}
+
+func (rec *Recorder) recordInteraction(r *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	transport := rec.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	response, err := transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Interaction{}
+	i.Request.Method = r.Method
+	i.Request.URL = recorded.URL
+	i.Request.Body = recorded.Body
+	i.Response.Status = response.StatusCode
+	i.Response.Header = response.Header.Clone()
+	i.Response.Body = body
+
+	rec.mu.Lock()
+	rec.interactions = append(rec.interactions, i)
+	rec.mu.Unlock()
+
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return response, nil
+}
+
+// Save writes the recorded interactions to the golden file. It does nothing when replaying
+func (rec *Recorder) Save() error {
+	if rec.Mode != ModeRecord {
+		return nil
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	out, err := json.MarshalIndent(rec.interactions, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(rec.GoldenFile, append(out, '\n'), 0644)
+}
@@ -0,0 +1,215 @@
+package tooltest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransport_Expectations(t *testing.T) {
+	tr := NewTransport()
+	tr.Expect("POST", "/events").
+		WithHeader("Content-Type", "application/json").
+		WithJSONBody(`{"b": 2, "a": 1}`).
+		RespondJSON(http.StatusCreated, map[string]string{"id": "123"})
+	tr.Expect("GET", "/events").WithQuery("page", "2").Respond(http.StatusOK, "[]").Times(2)
+	tr.Expect("DELETE", "/events/1").RespondError(errors.New("connection reset"))
+
+	client := tr.Client()
+
+	req, _ := http.NewRequest("POST", "http://example.com/events", strings.NewReader(`{"a":1,"b":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated || string(body) != `{"id":"123"}` {
+		t.Errorf("wrong response: %d %s", res.StatusCode, body)
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err = client.Get("http://example.com/events?page=2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("wrong status: %d", res.StatusCode)
+		}
+	}
+
+	req, _ = http.NewRequest("DELETE", "http://example.com/events/1", nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("expected the request to fail")
+	}
+
+	requests := tr.Requests()
+	if len(requests) != 4 {
+		t.Fatalf("expected 4 recorded requests but got %d", len(requests))
+	}
+
+	var sent map[string]int
+	if err := requests[0].JSON(&sent); err != nil || sent["a"] != 1 {
+		t.Errorf("wrong body recorded: %s", requests[0].Body)
+	}
+
+	tr.AssertExpectations(t)
+}
+
+func TestTransport_Unmatched(t *testing.T) {
+	tr := NewTransport()
+	tr.Expect("GET", "/ok")
+	tr.Expect("GET", "/never")
+
+	res, err := tr.Client().Get("http://example.com/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNotImplemented {
+		t.Errorf("expected 501 for an unmatched request but got %d", res.StatusCode)
+	}
+
+	mock := &testing.T{}
+	tr.AssertExpectations(mock)
+	if !mock.Failed() {
+		t.Error("expected unmet expectations and unmatched requests to fail the test")
+	}
+}
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Echo", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("got " + string(body)))
+	}))
+
+	golden := filepath.Join(t.TempDir(), "interactions.golden.json")
+
+	rec, err := NewRecorder(golden, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := rec.Client().Post(srv.URL+"/push", "application/json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if string(body) != `got {"a":1}` {
+		t.Errorf("wrong recorded response: %s", body)
+	}
+
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server is gone, so replaying must come from the golden file
+	srv.Close()
+
+	replay, err := NewRecorder(golden, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = replay.Client().Post(srv.URL+"/push", "application/json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted || res.Header.Get("X-Echo") != "yes" || string(body) != `got {"a":1}` {
+		t.Errorf("wrong replayed response: %d %v %s", res.StatusCode, res.Header, body)
+	}
+
+	// each interaction is only replayed once, and a different body doesn't match
+	if _, err := replay.Client().Post(srv.URL+"/push", "application/json", strings.NewReader(`{"a":1}`)); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("expected ErrNoInteraction but got %v", err)
+	}
+}
+
+func TestRecorder_BinaryBodies(t *testing.T) {
+	// a gzipped request and a binary response, neither of which is valid UTF-8
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	_, _ = zw.Write([]byte(`{"a":1}`))
+	zw.Close()
+
+	image := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00, 0xfe}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(image)
+	}))
+
+	golden := filepath.Join(t.TempDir(), "binary.golden.json")
+
+	rec, err := NewRecorder(golden, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := rec.Client().Post(srv.URL+"/push", "application/json", bytes.NewReader(gzipped.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	replay, err := NewRecorder(golden, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = replay.Client().Post(srv.URL+"/push", "application/json", bytes.NewReader(gzipped.Bytes()))
+	if err != nil {
+		t.Fatalf("gzipped request didn't match on replay: %s", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if !bytes.Equal(body, image) {
+		t.Errorf("binary response corrupted: %v", body)
+	}
+}
+
+func TestBody_JSON(t *testing.T) {
+	for _, body := range []Body{Body("plain text"), Body{0xff, 0x00, 0xfe}} {
+		out, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded Body
+		if err := json.Unmarshal(out, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(decoded, body) {
+			t.Errorf("%s didn't round trip", out)
+		}
+	}
+
+	if out, _ := json.Marshal(Body("plain text")); string(out) != `"plain text"` {
+		t.Errorf("text should be saved as a string, got %s", out)
+	}
+}
@@ -0,0 +1,117 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSignatureMissing is returned when a webhook arrives without a signature header
+	ErrSignatureMissing = errors.New("webhook signature missing")
+	// ErrSignatureInvalid is returned when a webhook signature is malformed or doesn't match the body
+	ErrSignatureInvalid = errors.New("webhook signature invalid")
+	// ErrSignatureExpired is returned when a webhook was signed outside of the replay window
+	ErrSignatureExpired = errors.New("webhook signature expired")
+)
+
+// webhookSignatureHeader is the header holding the signature, unless WebhookSignatureHeader is set
+func (t *Tools) webhookSignatureHeader() string {
+	if t.WebhookSignatureHeader == "" {
+		return "X-Webhook-Signature"
+	}
+	return t.WebhookSignatureHeader
+}
+
+// SignWebhook returns the signature header value for payload, in the form t=<unix time>,v1=<hex>.
+// The signature is an HMAC-SHA256 of the timestamp and payload joined by a dot, so a captured
+// request can't be replayed with a new timestamp
+func (t *Tools) SignWebhook(payload []byte, secret string, timestamp time.Time) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, webhookMAC(payload, secret, ts))
+}
+
+func webhookMAC(payload []byte, secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature of an incoming webhook against any of the given secrets, so
+// secrets can be rotated, and rejects requests signed more than WebhookTolerance ago. The signature
+// covers the body exactly as it was sent, so the body is read before it is decompressed and put back
+// afterwards for ReadJSON to decode
+func (t *Tools) VerifyWebhook(w http.ResponseWriter, r *http.Request, secrets ...string) error {
+	header := r.Header.Get(t.webhookSignatureHeader())
+	if header == "" {
+		return ErrSignatureMissing
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrSignatureInvalid
+	}
+
+	tolerance := 5 * time.Minute
+	if t.WebhookTolerance != 0 {
+		tolerance = t.WebhookTolerance
+	}
+
+	age := time.Since(time.Unix(unix, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	maxBytes := 1024 * 1024
+	if t.MaxJsonSize != 0 {
+		maxBytes = t.MaxJsonSize
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		return jsonDecodeError(err, maxBytes)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	for _, secret := range secrets {
+		expected := []byte(webhookMAC(body, secret, timestamp))
+		for _, signature := range signatures {
+			if hmac.Equal(expected, []byte(signature)) {
+				return nil
+			}
+		}
+	}
+
+	return ErrSignatureInvalid
+}
+
+// ReadSignedJSON verifies an incoming webhook with VerifyWebhook and then decodes it with ReadJSON
+func (t *Tools) ReadSignedJSON(w http.ResponseWriter, r *http.Request, data interface{}, secrets ...string) error {
+	if err := t.VerifyWebhook(w, r, secrets...); err != nil {
+		return err
+	}
+
+	return t.ReadJSON(w, r, data)
+}
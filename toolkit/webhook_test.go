@@ -0,0 +1,91 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTools_SignedWebhookRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var received struct {
+			Event string `json:"event"`
+		}
+		var readErr error
+
+		receiver := &Tools{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			readErr = receiver.ReadSignedJSON(w, r, &received, "old-secret", "new-secret")
+		}))
+
+		sender := &Tools{CompressRemoteJSON: compress}
+		response, err := sender.CallRemote(context.Background(), RemoteRequest{
+			URL:           srv.URL,
+			Data:          map[string]string{"event": "created"},
+			SigningSecret: "new-secret",
+		})
+		srv.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+
+		if readErr != nil {
+			t.Errorf("compressed %v: error not expected but one received: %s", compress, readErr)
+		}
+
+		if received.Event != "created" {
+			t.Errorf("compressed %v: wrong event decoded: %q", compress, received.Event)
+		}
+	}
+}
+
+var verifyWebhookTests = []struct {
+	name          string
+	body          string
+	signedBody    string
+	secret        string
+	signedAt      time.Time
+	header        string
+	expectedError error
+}{
+	{name: "valid", body: `{"a":1}`, signedBody: `{"a":1}`, secret: "secret", signedAt: time.Now()},
+	{name: "wrong secret", body: `{"a":1}`, signedBody: `{"a":1}`, secret: "other", signedAt: time.Now(), expectedError: ErrSignatureInvalid},
+	{name: "tampered body", body: `{"a":2}`, signedBody: `{"a":1}`, secret: "secret", signedAt: time.Now(), expectedError: ErrSignatureInvalid},
+	{name: "too old", body: `{"a":1}`, signedBody: `{"a":1}`, secret: "secret", signedAt: time.Now().Add(-time.Hour), expectedError: ErrSignatureExpired},
+	{name: "too far in the future", body: `{"a":1}`, signedBody: `{"a":1}`, secret: "secret", signedAt: time.Now().Add(time.Hour), expectedError: ErrSignatureExpired},
+	{name: "missing", body: `{"a":1}`, header: "-", expectedError: ErrSignatureMissing},
+	{name: "malformed", body: `{"a":1}`, header: "v1=abc", expectedError: ErrSignatureInvalid},
+}
+
+func TestTools_VerifyWebhook(t *testing.T) {
+	tool := &Tools{}
+
+	for _, e := range verifyWebhookTests {
+		req := httptest.NewRequest("POST", "/", bytes.NewBufferString(e.body))
+
+		switch e.header {
+		case "":
+			req.Header.Set("X-Webhook-Signature", tool.SignWebhook([]byte(e.signedBody), e.secret, e.signedAt))
+		case "-":
+		default:
+			req.Header.Set("X-Webhook-Signature", e.header)
+		}
+
+		rr := httptest.NewRecorder()
+		err := tool.VerifyWebhook(rr, req, "secret")
+
+		if e.expectedError == nil && err != nil {
+			t.Errorf("%s: error not expected but one received: %s", e.name, err.Error())
+		}
+
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected error %q but got %v", e.name, e.expectedError, err)
+		}
+	}
+}
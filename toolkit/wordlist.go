@@ -0,0 +1,70 @@
+package toolkit
+
+// passphraseWords is the list NewPassphrase picks words from. The words are short, common and easy to
+// spell, and there are 512 of them so each word adds 9 bits of entropy
+var passphraseWords = []string{
+	"able", "acid", "acorn", "actor", "adapt", "admit", "adult", "agent",
+	"agree", "ahead", "aisle", "alarm", "album", "alert", "alien", "alley",
+	"allow", "alpha", "amber", "ample", "angle", "ankle", "apple", "april",
+	"apron", "arena", "argue", "armor", "arrow", "artist", "aspen", "atlas",
+	"attic", "audio", "aunt", "autumn", "avoid", "awake", "award", "bacon",
+	"badge", "bagel", "baker", "balmy", "bamboo", "banjo", "barn", "basil",
+	"basin", "batch", "beach", "beard", "beast", "begin", "bench", "berry",
+	"bike", "bird", "bison", "blade", "blank", "blast", "blaze", "blend",
+	"bliss", "block", "bloom", "blue", "blush", "board", "boat", "bonus",
+	"book", "boost", "booth", "bored", "bottle", "brave", "bread", "brick",
+	"bride", "brief", "brisk", "broom", "brush", "bubble", "bucket", "buddy",
+	"bugle", "build", "bulb", "bunny", "cabin", "cable", "cactus", "camel",
+	"camp", "canal", "candy", "canoe", "canvas", "cargo", "carpet", "carrot",
+	"carve", "castle", "cedar", "chalk", "charm", "chart", "chase", "cheek",
+	"cheese", "cherry", "chess", "chest", "chief", "child", "chili", "chin",
+	"chip", "choir", "cider", "cinema", "circle", "civic", "clam", "clay",
+	"clerk", "cliff", "climb", "clock", "cloth", "cloud", "clown", "coach",
+	"coast", "cobra", "cocoa", "comet", "comic", "coral", "cotton", "couch",
+	"cover", "crab", "craft", "crane", "crisp", "crow", "crown", "crumb",
+	"cube", "curly", "curve", "cycle", "daily", "dairy", "daisy", "dance",
+	"dart", "dawn", "decal", "deck", "delta", "denim", "depth", "desk",
+	"dial", "diary", "dice", "diner", "ditch", "diver", "dizzy", "dock",
+	"dodge", "donut", "dove", "dozen", "draft", "dragon", "drama", "dream",
+	"dress", "drift", "drill", "drum", "duck", "dune", "dusty", "eagle",
+	"early", "earth", "easel", "echo", "edge", "eel", "elbow", "elder",
+	"elk", "elm", "ember", "empty", "enjoy", "entry", "epic", "equal",
+	"eraser", "essay", "exact", "exit", "fable", "fabric", "fairy", "falcon",
+	"fancy", "farm", "fawn", "feast", "fence", "ferry", "fiber", "field",
+	"fig", "film", "finch", "fjord", "flag", "flame", "flask", "flint",
+	"float", "flock", "flute", "foam", "focus", "foggy", "forest", "fork",
+	"fossil", "fox", "frame", "fresh", "frog", "frost", "fruit", "fudge",
+	"gadget", "galaxy", "garden", "garlic", "gate", "gecko", "gem", "giant",
+	"ginger", "glad", "glass", "globe", "glove", "goat", "gold", "goose",
+	"gorge", "grain", "grape", "grass", "gravel", "green", "grid", "grill",
+	"grove", "guitar", "gull", "habit", "hammer", "harbor", "harp", "hatch",
+	"hawk", "hazel", "heart", "hedge", "helmet", "hero", "heron", "hill",
+	"hippo", "hobby", "honey", "hood", "hook", "hope", "horse", "hotel",
+	"house", "humble", "hut", "icon", "igloo", "image", "inch", "index",
+	"ink", "input", "iris", "iron", "island", "ivory", "ivy", "jacket",
+	"jade", "jam", "jar", "jazz", "jelly", "jewel", "jog", "joke",
+	"jolly", "judge", "juice", "jumbo", "kayak", "key", "kite", "kiwi",
+	"knee", "knot", "koala", "label", "lake", "lamp", "laser", "latch",
+	"lava", "lawn", "layer", "leaf", "lemon", "lens", "level", "lilac",
+	"lily", "lime", "linen", "lion", "llama", "lobby", "lodge", "lotus",
+	"lucky", "lunar", "lunch", "lynx", "magic", "mango", "maple", "marsh",
+	"mask", "melon", "metal", "mint", "mocha", "model", "moose", "moss",
+	"motel", "mouse", "mural", "music", "nacho", "navy", "nest", "night",
+	"ninja", "noble", "north", "novel", "oak", "oasis", "ocean", "olive",
+	"omega", "onion", "opal", "orbit", "otter", "oven", "owl", "palm",
+	"panda", "paper", "pasta", "patch", "peach", "pearl", "pecan", "pedal",
+	"piano", "pilot", "pine", "pixel", "pizza", "plum", "polar", "pony",
+	"poppy", "prism", "pulse", "puppy", "quail", "queen", "quest", "quiet",
+	"quilt", "quiz", "radar", "radio", "raft", "rain", "ranch", "raven",
+	"razor", "reef", "relay", "rider", "ridge", "river", "robin", "robot",
+	"rodeo", "rose", "ruby", "rugby", "ruler", "salad", "salsa", "sand",
+	"satin", "scarf", "scout", "seal", "shark", "sheep", "shell", "shore",
+	"silk", "siren", "skunk", "sled", "slope", "smile", "snail", "snake",
+	"solar", "sonic", "spark", "spice", "spoon", "squid", "stamp", "star",
+	"steam", "stone", "storm", "straw", "sugar", "sunny", "swan", "sweet",
+	"syrup", "table", "taco", "talon", "tango", "tiger", "toast", "token",
+	"topaz", "torch", "towel", "tower", "trail", "tram", "trout", "tulip",
+	"tuna", "tweed", "twig", "uncle", "urban", "vapor", "visor", "vivid",
+	"wafer", "wagon", "wand", "water", "wave", "whale", "wheat", "whisk",
+	"wolf", "yacht", "yarn", "yodel", "zebra", "zero", "zinc", "zone",
+}